@@ -0,0 +1,240 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree/internal/wire"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func assertBinaryImplementation() {
+	var _ encoding.BinaryMarshaler = (*Tree)(nil)
+	var _ encoding.BinaryUnmarshaler = (*Tree)(nil)
+}
+
+// The binary format is
+//
+//	magic    "CRBT"
+//	version  byte
+//	keyType  uvarint length followed by the name of the key type, see utils.RegisterKeyType
+//	encoding byte, binaryKeysCodec or binaryKeysDelta
+//	n        uvarint number of distinct keys
+//	entries  n times key followed by uvarint count, in-order
+//
+// With binaryKeysCodec each key is its codec's encoding prefixed by uvarint length.
+// With binaryKeysDelta, used for keys whose codec implements utils.OrdinalKeyCodec,
+// the first key is its uvarint ordinal and every following key the uvarint difference
+// of its ordinal to the previous one.
+const (
+	binaryMagic   = "CRBT"
+	binaryVersion = 1
+
+	binaryKeysCodec byte = 0
+	binaryKeysDelta byte = 1
+)
+
+// ErrNoKeyType is returned when serializing a tree whose comparator is not registered with utils.RegisterKeyType.
+var ErrNoKeyType = errors.New("redblacktree: comparator has no registered key type")
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// Keys are encoded with the codec registered for the tree's comparator, see utils.RegisterKeyType.
+func (tree *Tree) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tree.writeBinary(&buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+//
+// If the tree has no comparator the one registered for the recorded key type is used.
+// The tree is rebuilt in O(n). On error the tree is left unchanged.
+func (tree *Tree) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	newTree, err := readBinary(r, tree.Comparator, nil)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("redblacktree: %d trailing bytes after binary tree", r.Len())
+	}
+	tree.replaceWith(newTree)
+	return nil
+}
+
+// writeBinary writes the tree in the binary format, calling step, if not nil, after each entry.
+func (tree *Tree) writeBinary(w io.Writer, step func() error) error {
+	keyType, found := utils.KeyTypeOf(tree.Comparator)
+	if !found {
+		return ErrNoKeyType
+	}
+	bw := &wire.Writer{W: w}
+	bw.Write([]byte(binaryMagic))
+	bw.Write([]byte{binaryVersion})
+	bw.WriteBytes([]byte(keyType.Name))
+	encoder := entryEncoder{bw: bw, codec: keyType.Codec, keyEncoding: tree.keyEncoding(keyType.Codec)}
+	bw.Write([]byte{encoder.keyEncoding})
+	bw.WriteUvarint(uint64(tree.distinct()))
+	for node := tree.Left(); node != nil && bw.Err == nil; node = node.successor() {
+		encoder.encode(Entry{Key: node.Key, Count: node.NumRepeated + 1})
+		if step != nil && bw.Err == nil {
+			bw.Err = step()
+		}
+	}
+	return bw.Err
+}
+
+// readBinary reads a tree written by writeBinary, calling step, if not nil, after each entry.
+// If comparator is nil the one registered for the recorded key type is used.
+func readBinary(r io.ByteReader, comparator utils.Comparator, step func() error) (*Tree, error) {
+	br := &wire.Reader{R: r}
+	if magic := br.Read(len(binaryMagic)); br.Err == nil && string(magic) != binaryMagic {
+		return nil, fmt.Errorf("redblacktree: invalid binary tree magic %q", magic)
+	}
+	if version := br.Read(1); br.Err == nil && version[0] != binaryVersion {
+		return nil, fmt.Errorf("redblacktree: unsupported binary tree version %d", version[0])
+	}
+	name := string(br.ReadBytes())
+	keyEncoding := br.Read(1)[0]
+	n := br.ReadUvarint()
+	if br.Err != nil {
+		return nil, br.Err
+	}
+	decoder, err := newEntryDecoder(br, name, keyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(br.Remaining()) {
+		return nil, fmt.Errorf("redblacktree: %d keys exceed the input size", n)
+	}
+	if comparator == nil {
+		comparator = decoder.keyType.Comparator
+	} else if err := matchKeyType(name, comparator); err != nil {
+		return nil, err
+	}
+	newTree := NewWith(comparator)
+	err = newTree.buildSorted(int(n), func() (Entry, error) {
+		entry, err := decoder.decode()
+		if err == nil && step != nil {
+			err = step()
+		}
+		return entry, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newTree, nil
+}
+
+// keyEncoding returns binaryKeysDelta if the codec can delta encode the tree's keys
+// and binaryKeysCodec otherwise.
+func (tree *Tree) keyEncoding(codec utils.KeyCodec) byte {
+	ordinal, isOrdinal := codec.(utils.OrdinalKeyCodec)
+	if !isOrdinal {
+		return binaryKeysCodec
+	}
+	for node := tree.Left(); node != nil; node = node.successor() {
+		if next := node.successor(); next != nil && ordinal.Ordinal(node.Key) >= ordinal.Ordinal(next.Key) {
+			return binaryKeysCodec // comparator does not order keys by their ordinals
+		}
+	}
+	return binaryKeysDelta
+}
+
+// entryEncoder writes in-order entries as key followed by uvarint count.
+type entryEncoder struct {
+	bw          *wire.Writer
+	codec       utils.KeyCodec
+	keyEncoding byte
+	prev        uint64
+}
+
+func (encoder *entryEncoder) encode(entry Entry) {
+	if encoder.keyEncoding == binaryKeysDelta {
+		key := encoder.codec.(utils.OrdinalKeyCodec).Ordinal(entry.Key)
+		encoder.bw.WriteUvarint(key - encoder.prev)
+		encoder.prev = key
+	} else {
+		key, err := encoder.codec.Encode(entry.Key)
+		if err != nil {
+			if encoder.bw.Err == nil {
+				encoder.bw.Err = err
+			}
+			return
+		}
+		encoder.bw.WriteBytes(key)
+	}
+	encoder.bw.WriteUvarint(uint64(entry.Count))
+}
+
+// entryDecoder reads entries written by entryEncoder.
+type entryDecoder struct {
+	br          *wire.Reader
+	keyType     utils.KeyType
+	keyEncoding byte
+	prev        uint64
+	index       int
+}
+
+func newEntryDecoder(br *wire.Reader, name string, keyEncoding byte) (*entryDecoder, error) {
+	keyType, found := utils.KeyTypeByName(name)
+	if !found {
+		return nil, fmt.Errorf("redblacktree: unknown key type %q", name)
+	}
+	_, isOrdinal := keyType.Codec.(utils.OrdinalKeyCodec)
+	switch {
+	case keyEncoding == binaryKeysDelta && !isOrdinal:
+		return nil, fmt.Errorf("redblacktree: key type %q cannot be delta encoded", name)
+	case keyEncoding != binaryKeysDelta && keyEncoding != binaryKeysCodec:
+		return nil, fmt.Errorf("redblacktree: unknown key encoding %d", keyEncoding)
+	}
+	return &entryDecoder{br: br, keyType: keyType, keyEncoding: keyEncoding}, nil
+}
+
+func (decoder *entryDecoder) decode() (entry Entry, err error) {
+	br := decoder.br
+	if decoder.keyEncoding == binaryKeysDelta {
+		key := br.ReadUvarint()
+		if decoder.prev+key < decoder.prev {
+			return entry, fmt.Errorf("redblacktree: entry %d: invalid key delta %d", decoder.index, key)
+		}
+		decoder.prev += key
+		if br.Err == nil {
+			entry.Key, err = decoder.keyType.Codec.(utils.OrdinalKeyCodec).FromOrdinal(decoder.prev)
+		}
+	} else if key := br.ReadBytes(); br.Err == nil {
+		entry.Key, err = decoder.keyType.Codec.Decode(key)
+	}
+	if err != nil {
+		return entry, fmt.Errorf("redblacktree: entry %d: %v", decoder.index, err)
+	}
+	count := br.ReadUvarint()
+	if br.Err != nil {
+		return entry, br.Err
+	}
+	if count > uint64(maxInt) {
+		return entry, fmt.Errorf("redblacktree: entry %d: count %d overflows int", decoder.index, count)
+	}
+	entry.Count = int(count)
+	decoder.index++
+	return entry, nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// distinct returns the number of distinct keys in the tree.
+func (tree *Tree) distinct() (n int) {
+	for node := tree.Left(); node != nil; node = node.successor() {
+		n++
+	}
+	return
+}
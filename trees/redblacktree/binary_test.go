@@ -0,0 +1,192 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// assertValidTree checks ordering, red-black properties, parent pointers and counts.
+func assertValidTree(t *testing.T, tree *Tree) {
+	t.Helper()
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedBlackTreeBuildSorted(t *testing.T) {
+	for n := 0; n < 70; n++ {
+		tree := NewWithIntComparator()
+		i := 0
+		err := tree.buildSorted(n, func() (Entry, error) {
+			i++
+			return Entry{Key: i * 2, Count: i%3 + 1}, nil
+		})
+		if err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		assertValidTree(t, tree)
+		for j := 0; j < 2*n+2; j++ {
+			tree.Put(j)
+		}
+		for j := 0; j < 2*n+2; j += 3 {
+			tree.Remove(j)
+		}
+		assertValidTree(t, tree)
+	}
+}
+
+func TestRedBlackTreeBinaryGolden(t *testing.T) {
+	ints := NewWithIntComparator()
+	for _, key := range []int{-1000, 3, 3, 4, 1 << 30, 7, 7, 7} {
+		ints.Put(key)
+	}
+	strs := NewWithStringComparator()
+	for _, key := range []string{"banana", "apple", "cherry", "apple"} {
+		strs.Put(key)
+	}
+	floats := NewWithFloat64Comparator()
+	for _, key := range []float64{2.5, -1, 0, 2.5} {
+		floats.Put(key)
+	}
+	for name, tree := range map[string]*Tree{"int": ints, "string": strs, "float64": floats, "empty": NewWith(utils.UInt16Comparator)} {
+		data, err := tree.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		golden := filepath.Join("testdata", name+".bin.golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("%v: Got %x expected %x", name, data, expected)
+		}
+
+		restored := &Tree{}
+		if err := restored.UnmarshalBinary(expected); err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		assertValidTree(t, restored)
+		if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), fmt.Sprintf("%v", tree.Keys()); actualValue != expectedValue {
+			t.Errorf("%v: Got %v expected %v", name, actualValue, expectedValue)
+		}
+	}
+}
+
+func TestRedBlackTreeBinaryRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	tree := NewWith(utils.Int64Comparator)
+	for i := 0; i < 5000; i++ {
+		tree.Put(r.Int63n(1<<20) - 1<<19)
+	}
+	tree.Put(int64(1) << 40) // delta wider than 32 bits
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if data[len(binaryMagic)+2+len("int64")] != binaryKeysDelta {
+		t.Errorf("Expected delta encoding")
+	}
+	restored := NewWith(utils.Int64Comparator)
+	restored.Put(int64(1))
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	assertValidTree(t, restored)
+	if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), fmt.Sprintf("%v", tree.Keys()); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	// keys not ordered by their ordinals fall back to codec encoding
+	reversed := NewWith(reversedIntComparator)
+	for i := 0; i < 10; i++ {
+		reversed.Put(i)
+	}
+	data, err = reversed.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if data[len(binaryMagic)+2+len("redblacktree_test.reversedint")] != binaryKeysCodec {
+		t.Errorf("Expected codec encoding")
+	}
+	restored = &Tree{}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), "[9 8 7 6 5 4 3 2 1 0]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	unregistered := NewWith(func(a, b interface{}) int { return utils.IntComparator(a, b) })
+	if _, err := unregistered.MarshalBinary(); err != ErrNoKeyType {
+		t.Errorf("Got %v expected %v", err, ErrNoKeyType)
+	}
+}
+
+func reversedIntComparator(a, b interface{}) int {
+	return -utils.IntComparator(a, b)
+}
+
+func init() {
+	utils.RegisterKeyType(utils.KeyType{
+		Name:       "redblacktree_test.reversedint",
+		Type:       reflect.TypeOf(0),
+		Codec:      utils.IntCodec,
+		Comparator: reversedIntComparator,
+	})
+}
+
+func TestRedBlackTreeBinaryInvalid(t *testing.T) {
+	ints := NewWithIntComparator()
+	for _, key := range []int{-1000, 3, 3, 4, 1 << 30, 7, 7, 7} {
+		ints.Put(key)
+	}
+	valid, _ := ints.MarshalBinary()
+	tests := []struct {
+		data []byte
+		err  string
+	}{
+		{[]byte("XXXX\x01"), "invalid binary tree magic"},
+		{[]byte("CRBT\x02"), "unsupported binary tree version 2"},
+		{[]byte("CRBT\x01\x03foo\x00\x00"), `unknown key type "foo"`},
+		{[]byte("CRBT\x01\x06string\x01\x00"), `key type "string" cannot be delta encoded`},
+		{[]byte("CRBT\x01\x03int\x07\x00"), "unknown key encoding 7"},
+		{[]byte("CRBT\x01\x06string\x00\x00"), `key type "string" does not match tree's "int"`},
+		{[]byte("CRBT\x01\x03int\x01\x7f\x00"), "keys exceed the input size"},
+		{[]byte("CRBT\x01\x03int\x00\x01\x01\x02\x00"), "entry 0: count of key 1 must be positive"},
+		{[]byte("CRBT\x01\x03int\x00\x02\x01\x02\x01\x01\x02\x01"), "entry 1: duplicate key 1"},
+		{[]byte("CRBT\x01\x03int\x00\x02\x01\x02\x01\x01\x01\x01"), "entry 1: key -1 is not sorted after 1"},
+		{valid[:len(valid)-1], "unexpected EOF"},
+		{append(valid, 0), "1 trailing bytes"},
+	}
+	for _, test := range tests {
+		tree := NewWithIntComparator()
+		tree.Put(42)
+		if err := tree.UnmarshalBinary(test.data); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Got %v expected %v", err, test.err)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[42]"; actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package crdt implements a conflict-free replicated multiset on top of a counted red-black tree.
+//
+// Every replica counts the increments and decrements it made to each key, as in a PN-counter.
+// Replicas exchange their states, or only the deltas of their recent changes, in any order and
+// any number of times: merging converges to the same multiset on every replica.
+// The multiplicity of a key is its increments less its decrements over all replicas, but at least zero,
+// and is kept in a redblacktree.Tree for CountSmaller, Select and iteration over the merged view.
+//
+// Keys must be of a type registered with utils.RegisterKeyType, whose codec identifies equal keys.
+//
+// Structure is not thread safe.
+package crdt
+
+import (
+	"fmt"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// Multiset is the replica of a conflict-free replicated multiset.
+type Multiset struct {
+	replica string
+	state   *State
+	delta   *State // changes since the last call to Delta
+	tree    *redblacktree.Tree
+}
+
+// New returns an empty multiset for the named replica, which must be unique among the replicas.
+// The comparator must be registered with utils.RegisterKeyType.
+func New(replica string, comparator utils.Comparator) (*Multiset, error) {
+	keyType, found := utils.KeyTypeOf(comparator)
+	if !found {
+		return nil, redblacktree.ErrNoKeyType
+	}
+	return &Multiset{
+		replica: replica,
+		state:   newState(keyType),
+		delta:   newState(keyType),
+		tree:    redblacktree.NewWith(comparator),
+	}, nil
+}
+
+// Replica returns the name of the replica.
+func (multiset *Multiset) Replica() string {
+	return multiset.replica
+}
+
+// Tree returns the tree holding the multiplicity of every key. It must not be mutated.
+func (multiset *Multiset) Tree() *redblacktree.Tree {
+	return multiset.tree
+}
+
+// Count returns the multiplicity of the key.
+func (multiset *Multiset) Count(key interface{}) int {
+	return multiset.state.Count(key)
+}
+
+// Size returns the number of elements counting repetitions.
+func (multiset *Multiset) Size() int {
+	return multiset.tree.Size()
+}
+
+// Add adds n occurrences of the key, it does nothing if n is not positive.
+//
+// The multiplicity of a key is the sum of its increments less the sum of its decrements on all replicas,
+// but at least zero. Concurrent removals that together remove more occurrences than there were leave
+// excess decrements that absorb as many later additions: after replicas a and b both removed the only
+// occurrence of a key and merged, a.Add(key, 1) leaves its multiplicity zero and a second Add raises it to one.
+func (multiset *Multiset) Add(key interface{}, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	return multiset.update(key, func(counter *Counter, visible int) {
+		counter.Inc += uint64(n)
+	})
+}
+
+// Remove removes up to n occurrences of the key and returns the number removed.
+// Concurrent removals on other replicas may remove the same occurrences, the multiplicity stays at least zero
+// and the excess decrements absorb later additions, see Add.
+func (multiset *Multiset) Remove(key interface{}, n int) (int, error) {
+	removed := 0
+	if n <= 0 {
+		return 0, nil
+	}
+	err := multiset.update(key, func(counter *Counter, visible int) {
+		if removed = n; removed > visible {
+			removed = visible
+		}
+		counter.Dec += uint64(removed)
+	})
+	return removed, err
+}
+
+// update changes the replica's counter of the key and records it in the delta.
+func (multiset *Multiset) update(key interface{}, change func(counter *Counter, visible int)) error {
+	encoded, err := multiset.state.keyType.Codec.Encode(key)
+	if err != nil {
+		return fmt.Errorf("crdt: %v", err)
+	}
+	e := multiset.state.entries[string(encoded)]
+	visible := 0
+	var counter Counter
+	if e != nil {
+		visible = e.visible()
+		counter = e.counters[multiset.replica]
+	}
+	change(&counter, visible)
+	multiset.state.set(string(encoded), key, multiset.replica, counter)
+	multiset.delta.set(string(encoded), key, multiset.replica, counter)
+	multiset.sync(multiset.state.entries[string(encoded)], visible)
+	return nil
+}
+
+// sync updates the tree with the entry's multiplicity, which was visible before.
+func (multiset *Multiset) sync(e *entry, visible int) {
+	if count := e.visible(); count > visible {
+		multiset.tree.PutN(e.key, count-visible)
+	} else if count < visible {
+		multiset.tree.RemoveN(e.key, visible-count)
+	}
+}
+
+// State returns a copy of the full state of the replica, to be merged into other replicas.
+func (multiset *Multiset) State() *State {
+	return multiset.state.clone()
+}
+
+// Delta returns the changes since the previous call to Delta, made locally or merged from other replicas.
+// Merging the deltas of every call brings another replica to the same state as merging State.
+func (multiset *Multiset) Delta() *State {
+	delta := multiset.delta
+	multiset.delta = newState(delta.keyType)
+	return delta
+}
+
+// Merge merges the state or delta of another replica.
+// Merging is commutative, associative and idempotent, so states may be merged in any order and repeatedly.
+func (multiset *Multiset) Merge(state *State) error {
+	visible := make(map[string]int)
+	for encoded := range state.entries {
+		if e := multiset.state.entries[encoded]; e != nil {
+			visible[encoded] = e.visible()
+		}
+	}
+	err := multiset.state.merge(state, func(encoded string, e *entry) {
+		multiset.sync(e, visible[encoded])
+	})
+	if err != nil {
+		return err
+	}
+	// relay the changes so replicas syncing only deltas with this one also receive them
+	return multiset.delta.merge(state, nil)
+}
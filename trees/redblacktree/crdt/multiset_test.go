@@ -0,0 +1,144 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crdt
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// assertConsistent checks that the tree holds the multiplicity of every key.
+func assertConsistent(t *testing.T, multiset *Multiset) {
+	t.Helper()
+	size := 0
+	for _, e := range multiset.state.entries {
+		first, last := multiset.tree.EqualRange(e.key)
+		if actualValue, expectedValue := last-first, e.visible(); actualValue != expectedValue {
+			t.Fatalf("Got %v occurrences of %v expected %v", actualValue, e.key, expectedValue)
+		}
+		size += e.visible()
+	}
+	if actualValue := multiset.Size(); actualValue != size {
+		t.Fatalf("Got size %v expected %v", actualValue, size)
+	}
+}
+
+func keys(multiset *Multiset) string {
+	return fmt.Sprintf("%v", multiset.Tree().Keys())
+}
+
+func TestMultiset(t *testing.T) {
+	a, _ := New("a", utils.IntComparator)
+	b, _ := New("b", utils.IntComparator)
+	a.Add(1, 3)
+	a.Add(2, 1)
+	b.Add(1, 2)
+	if removed, _ := b.Remove(1, 5); removed != 2 {
+		t.Errorf("Got %v expected %v", removed, 2)
+	}
+	b.Add(3, 2)
+
+	a.Merge(b.State())
+	b.Merge(a.State())
+	for _, multiset := range []*Multiset{a, b} {
+		assertConsistent(t, multiset)
+		if actualValue, expectedValue := keys(multiset), "[1 1 1 2 3 3]"; actualValue != expectedValue {
+			t.Errorf("%v: Got %v expected %v", multiset.Replica(), actualValue, expectedValue)
+		}
+	}
+	if actualValue, expectedValue := a.Tree().CountSmaller(3), 4; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	// concurrent removals of the same occurrences do not go below zero,
+	// the excess decrement absorbs the next addition
+	a.Remove(2, 1)
+	b.Remove(2, 1)
+	a.Merge(b.State())
+	for _, expectedValue := range []int{0, 0, 1} {
+		if actualValue := a.Count(2); actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+		assertConsistent(t, a)
+		a.Add(2, 1)
+	}
+
+	if _, err := New("c", func(a, b interface{}) int { return 0 }); err == nil {
+		t.Errorf("Got no error for unregistered comparator")
+	}
+	strs, _ := New("c", utils.StringComparator)
+	if err := strs.Merge(a.State()); err == nil {
+		t.Errorf("Got no error merging different key types")
+	}
+}
+
+func TestMultisetConvergence(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var replicas []*Multiset
+	for _, replica := range []string{"a", "b", "c"} {
+		multiset, _ := New(replica, utils.IntComparator)
+		replicas = append(replicas, multiset)
+	}
+	var states []*State
+	for round := 0; round < 20; round++ {
+		for _, multiset := range replicas {
+			for i := 0; i < 20; i++ {
+				if r.Intn(3) == 0 {
+					multiset.Remove(r.Intn(30), r.Intn(3)+1)
+				} else {
+					multiset.Add(r.Intn(30), r.Intn(3)+1)
+				}
+			}
+			states = append(states, multiset.Delta())
+		}
+		// gossip full states between random pairs
+		from, to := replicas[r.Intn(3)], replicas[r.Intn(3)]
+		to.Merge(from.State())
+	}
+
+	// merging every delta in any order, repeatedly, converges
+	merged := make([]*Multiset, 3)
+	for i := range merged {
+		merged[i], _ = New(fmt.Sprintf("observer%d", i), utils.IntComparator)
+		order := r.Perm(len(states))
+		for _, j := range order {
+			merged[i].Merge(states[j])
+			if r.Intn(4) == 0 {
+				merged[i].Merge(states[order[r.Intn(len(order))]])
+			}
+		}
+		assertConsistent(t, merged[i])
+	}
+	for _, multiset := range replicas {
+		for _, other := range replicas {
+			multiset.Merge(other.State())
+		}
+	}
+	for _, multiset := range append(replicas, merged...) {
+		assertConsistent(t, multiset)
+		if actualValue, expectedValue := keys(multiset), keys(merged[0]); actualValue != expectedValue {
+			t.Errorf("%v: Got %v expected %v", multiset.Replica(), actualValue, expectedValue)
+		}
+	}
+}
+
+func TestMultisetDeltaRelay(t *testing.T) {
+	a, _ := New("a", utils.IntComparator)
+	b, _ := New("b", utils.IntComparator)
+	c, _ := New("c", utils.IntComparator)
+	a.Add(1, 2)
+	b.Merge(a.Delta())
+	b.Add(2, 1)
+	c.Merge(b.Delta())
+	if actualValue, expectedValue := keys(c), "[1 1 2]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if actualValue, expectedValue := a.Delta().Len(), 0; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crdt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree/internal/wire"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// The binary format of a state is
+//
+//	magic    "CRBTCRDT"
+//	version  byte
+//	keyType  uvarint length followed by the name of the key type, see utils.RegisterKeyType
+//	n        uvarint number of keys
+//	keys     n times the key's codec encoding prefixed by its uvarint length, the uvarint number
+//	         of replicas and per replica its name prefixed by its uvarint length and its uvarint
+//	         increments and decrements, keys and replicas in-order
+const (
+	magic   = "CRBTCRDT"
+	version = 1
+)
+
+// Counter holds the increments and decrements of a key by a single replica.
+type Counter struct {
+	Inc uint64
+	Dec uint64
+}
+
+// State is the state of a multiset: per key and replica the counter of its increments and decrements.
+// States form a join-semilattice: merging takes the maximum of every counter, so merges are commutative,
+// associative and idempotent.
+//
+// The zero value is an empty state to be decoded with UnmarshalBinary.
+type State struct {
+	keyType utils.KeyType
+	entries map[string]*entry // by the key's codec encoding
+}
+
+// entry holds the counters of a key by replica.
+type entry struct {
+	key      interface{}
+	counters map[string]Counter
+}
+
+// visible returns the multiplicity of the key, its increments less its decrements, but at least zero.
+func (e *entry) visible() int {
+	var inc, dec uint64
+	for _, counter := range e.counters {
+		inc += counter.Inc
+		dec += counter.Dec
+	}
+	if dec >= inc {
+		return 0
+	}
+	if inc-dec > uint64(maxInt) {
+		return maxInt
+	}
+	return int(inc - dec)
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+func newState(keyType utils.KeyType) *State {
+	return &State{keyType: keyType, entries: make(map[string]*entry)}
+}
+
+// Len returns the number of keys with counters, including keys whose multiplicity is zero.
+func (state *State) Len() int {
+	return len(state.entries)
+}
+
+// Count returns the multiplicity of the key.
+func (state *State) Count(key interface{}) int {
+	e, _ := state.lookup(key)
+	if e == nil {
+		return 0
+	}
+	return e.visible()
+}
+
+// Counters returns a copy of the key's counters by replica.
+func (state *State) Counters(key interface{}) map[string]Counter {
+	counters := make(map[string]Counter)
+	if e, _ := state.lookup(key); e != nil {
+		for replica, counter := range e.counters {
+			counters[replica] = counter
+		}
+	}
+	return counters
+}
+
+func (state *State) lookup(key interface{}) (*entry, string) {
+	encoded, err := state.keyType.Codec.Encode(key)
+	if err != nil {
+		return nil, ""
+	}
+	return state.entries[string(encoded)], string(encoded)
+}
+
+// set raises the counter of key by replica to at least counter and returns whether it changed.
+func (state *State) set(encoded string, key interface{}, replica string, counter Counter) bool {
+	e := state.entries[encoded]
+	if e == nil {
+		e = &entry{key: key, counters: make(map[string]Counter)}
+		state.entries[encoded] = e
+	}
+	old, found := e.counters[replica]
+	if counter.Inc < old.Inc {
+		counter.Inc = old.Inc
+	}
+	if counter.Dec < old.Dec {
+		counter.Dec = old.Dec
+	}
+	e.counters[replica] = counter
+	return !found || counter != old
+}
+
+// merge joins other into the state and calls changed with every key whose counters changed.
+func (state *State) merge(other *State, changed func(encoded string, e *entry)) error {
+	if other.keyType.Name != state.keyType.Name {
+		return fmt.Errorf("crdt: cannot merge key type %q into %q", other.keyType.Name, state.keyType.Name)
+	}
+	for encoded, e := range other.entries {
+		modified := false
+		for replica, counter := range e.counters {
+			if state.set(encoded, e.key, replica, counter) {
+				modified = true
+			}
+		}
+		if modified && changed != nil {
+			changed(encoded, state.entries[encoded])
+		}
+	}
+	return nil
+}
+
+// clone returns a deep copy of the state.
+func (state *State) clone() *State {
+	c := newState(state.keyType)
+	c.merge(state, nil)
+	return c
+}
+
+// sorted returns the entries in-order.
+func (state *State) sorted() []*entry {
+	entries := make([]*entry, 0, len(state.entries))
+	for _, e := range state.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return state.keyType.Comparator(entries[i].key, entries[j].key) < 0
+	})
+	return entries
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (state *State) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := &wire.Writer{W: &buf}
+	w.Write([]byte(magic))
+	w.Write([]byte{version})
+	w.WriteBytes([]byte(state.keyType.Name))
+	w.WriteUvarint(uint64(len(state.entries)))
+	for _, e := range state.sorted() {
+		encoded, err := state.keyType.Codec.Encode(e.key)
+		if err != nil {
+			return nil, err
+		}
+		w.WriteBytes(encoded)
+		replicas := make([]string, 0, len(e.counters))
+		for replica := range e.counters {
+			replicas = append(replicas, replica)
+		}
+		sort.Strings(replicas)
+		w.WriteUvarint(uint64(len(replicas)))
+		for _, replica := range replicas {
+			w.WriteBytes([]byte(replica))
+			w.WriteUvarint(e.counters[replica].Inc)
+			w.WriteUvarint(e.counters[replica].Dec)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, replacing the state.
+// The key type must be registered with utils.RegisterKeyType.
+func (state *State) UnmarshalBinary(data []byte) error {
+	r := &wire.Reader{R: bytes.NewReader(data)}
+	if string(r.Read(len(magic))) != magic || r.Read(1)[0] != version {
+		return errors.New("crdt: not a state or unsupported version")
+	}
+	name := string(r.ReadBytes())
+	if r.Err != nil {
+		return r.Err
+	}
+	keyType, found := utils.KeyTypeByName(name)
+	if !found {
+		return fmt.Errorf("crdt: unknown key type %q", name)
+	}
+	newState := newState(keyType)
+	for n := r.ReadUvarint(); n > 0 && r.Err == nil; n-- {
+		encoded := r.ReadBytes()
+		if r.Err != nil {
+			break
+		}
+		key, err := keyType.Codec.Decode(encoded)
+		if err != nil {
+			return fmt.Errorf("crdt: %v", err)
+		}
+		// re-encode so equal keys share an entry whatever their encoding in data
+		if encoded, err = keyType.Codec.Encode(key); err != nil {
+			return fmt.Errorf("crdt: %v", err)
+		}
+		for replicas := r.ReadUvarint(); replicas > 0 && r.Err == nil; replicas-- {
+			replica := string(r.ReadBytes())
+			counter := Counter{Inc: r.ReadUvarint(), Dec: r.ReadUvarint()}
+			if r.Err == nil {
+				newState.set(string(encoded), key, replica, counter)
+			}
+		}
+	}
+	if r.Err != nil {
+		return r.Err
+	}
+	if r.Remaining() != 0 {
+		return fmt.Errorf("crdt: %d trailing bytes after state", r.Remaining())
+	}
+	*state = *newState
+	return nil
+}
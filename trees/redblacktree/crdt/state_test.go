@@ -0,0 +1,59 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crdt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func TestStateBinary(t *testing.T) {
+	a, _ := New("a", utils.IntComparator)
+	b, _ := New("b", utils.IntComparator)
+	for i := 0; i < 100; i++ {
+		a.Add(i%10, i)
+		b.Add(i%7, 1)
+		b.Remove(i%5, 2)
+	}
+	a.Merge(b.State())
+	data, err := a.State().MarshalBinary()
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	var state State
+	if err := state.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := state.Len(), a.state.Len(); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if actualValue, expectedValue := fmt.Sprint(state.Counters(3)), fmt.Sprint(a.state.Counters(3)); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	again, _ := state.MarshalBinary()
+	if string(again) != string(data) {
+		t.Errorf("Got different encoding after round trip")
+	}
+
+	c, _ := New("c", utils.IntComparator)
+	c.Merge(&state)
+	assertConsistent(t, c)
+	if actualValue, expectedValue := keys(c), keys(a); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	d, _ := New("d", utils.IntComparator)
+	delta, _ := d.Delta().MarshalBinary()
+	if len(delta) >= len(data) {
+		t.Errorf("Got delta of %v bytes expected less than %v", len(delta), len(data))
+	}
+	for _, invalid := range [][]byte{nil, data[:len(data)-1], append(data, 0), []byte("CRBTCRDT\x01\x03foo\x00")} {
+		if err := state.UnmarshalBinary(invalid); err == nil {
+			t.Errorf("Got no error for %q", invalid)
+		}
+	}
+}
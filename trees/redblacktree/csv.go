@@ -0,0 +1,251 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// CSVOptions configures ExportCSV and ImportCSV.
+type CSVOptions struct {
+	// Comma is the field delimiter, ',' if zero.
+	Comma rune
+
+	// Header makes ExportCSV write a header row and ImportCSV skip the first row.
+	Header bool
+
+	// Cumulative adds a column to ExportCSV with the number of elements smaller than or equal to the key.
+	Cumulative bool
+
+	// Rank adds a column to ExportCSV with the number of elements smaller than the key.
+	Rank bool
+
+	// Lenient makes ImportCSV sum the counts of rows with equal keys instead of failing.
+	Lenient bool
+
+	// FormatKey converts keys to text, by default utils.ToString or RFC 3339 for time.Time.
+	FormatKey func(key interface{}) string
+
+	// ParseKey converts text to keys, by default according to the Go type of the key type
+	// registered for the tree's comparator, see utils.RegisterKeyType.
+	ParseKey func(text string) (interface{}, error)
+}
+
+// CSVError reports the line of the CSV input an import failed at.
+type CSVError struct {
+	Line int
+	Err  error
+}
+
+func (e *CSVError) Error() string {
+	return fmt.Sprintf("redblacktree: csv line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CSVError) Unwrap() error {
+	return e.Err
+}
+
+// ExportCSV writes one key,count row per key in-order, optionally followed by cumulative count and rank columns.
+func (tree *Tree) ExportCSV(w io.Writer, options CSVOptions) error {
+	writer := csv.NewWriter(w)
+	if options.Comma != 0 {
+		writer.Comma = options.Comma
+	}
+	formatKey := options.FormatKey
+	if formatKey == nil {
+		formatKey = formatCSVKey
+	}
+	if options.Header {
+		header := []string{"key", "count"}
+		if options.Cumulative {
+			header = append(header, "cumulative")
+		}
+		if options.Rank {
+			header = append(header, "rank")
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+	}
+	rank := 0
+	for node := tree.Left(); node != nil; node = node.successor() {
+		count := node.NumRepeated + 1
+		record := []string{formatKey(node.Key), strconv.Itoa(count)}
+		if options.Cumulative {
+			record = append(record, strconv.Itoa(rank+count))
+		}
+		if options.Rank {
+			record = append(record, strconv.Itoa(rank))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		rank += count
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ImportCSV replaces the tree's content with key,count rows in any order, ignoring further columns.
+// Rows with zero count are skipped. Rows repeating a key are an error unless options.Lenient is set.
+// Errors are reported as *CSVError holding the offending line. On error the tree is left unchanged.
+func (tree *Tree) ImportCSV(r io.Reader, options CSVOptions) error {
+	if tree.Comparator == nil {
+		return errors.New("redblacktree: importing CSV requires a comparator")
+	}
+	lines := &lineReader{r: bufio.NewReader(r)}
+	reader := csv.NewReader(lines)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	if options.Comma != 0 {
+		reader.Comma = options.Comma
+	}
+	parseKey := options.ParseKey
+	if parseKey == nil {
+		keyType, found := utils.KeyTypeOf(tree.Comparator)
+		if !found {
+			return ErrNoKeyType
+		}
+		parseKey = func(text string) (interface{}, error) {
+			return parseCSVKey(text, keyType.Type)
+		}
+	}
+
+	newTree := NewWith(tree.Comparator)
+	seen := NewWith(tree.Comparator) // keys of all rows, including those with zero count
+	for header := options.Header; ; header = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return &CSVError{Line: parseErr.Line, Err: parseErr.Err}
+			}
+			return err
+		}
+		line := lines.recordLine(record)
+		if header {
+			continue
+		}
+		if len(record) < 2 {
+			return &CSVError{Line: line, Err: fmt.Errorf("expected key and count, got %d fields", len(record))}
+		}
+		key, err := parseKey(record[0])
+		if err != nil {
+			return &CSVError{Line: line, Err: fmt.Errorf("invalid key %q: %v", record[0], err)}
+		}
+		count, err := strconv.Atoi(record[1])
+		if err != nil || count < 0 {
+			return &CSVError{Line: line, Err: fmt.Errorf("invalid count %q", record[1])}
+		}
+		if !options.Lenient {
+			if seen.Get(key) {
+				return &CSVError{Line: line, Err: fmt.Errorf("duplicate key %q", record[0])}
+			}
+			seen.Put(key)
+		}
+		newTree.PutN(key, count)
+	}
+	tree.replaceWith(newTree)
+	return nil
+}
+
+// lineReader returns at most one line per Read and counts the lines returned. A csv.Reader buffers
+// its input only up to the end of the line it parses, so the count tells the line of the last record.
+type lineReader struct {
+	r       *bufio.Reader
+	lines   int  // number of newlines returned
+	newline bool // whether the last byte returned was a newline
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		b, err := lr.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		p[n] = b
+		n++
+		lr.newline = b == '\n'
+		if lr.newline {
+			lr.lines++
+			break
+		}
+	}
+	return n, nil
+}
+
+// recordLine returns the line the record just read starts at.
+func (lr *lineReader) recordLine(record []string) int {
+	line := lr.lines
+	if !lr.newline {
+		line++ // the last line has no newline
+	}
+	for _, field := range record {
+		line -= strings.Count(field, "\n")
+	}
+	return line
+}
+
+func formatCSVKey(key interface{}) string {
+	switch key := key.(type) {
+	case time.Time:
+		return key.Format(time.RFC3339Nano)
+	case int:
+		return strconv.Itoa(key)
+	case uint:
+		return strconv.FormatUint(uint64(key), 10)
+	}
+	return utils.ToString(key)
+}
+
+func parseCSVKey(text string, typ reflect.Type) (interface{}, error) {
+	if typ == reflect.TypeOf(time.Time{}) {
+		return time.Parse(time.RFC3339Nano, text)
+	}
+	key := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.String:
+		key.SetString(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(text, 10, typ.Bits())
+		if err != nil {
+			return nil, err
+		}
+		key.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(text, 10, typ.Bits())
+		if err != nil {
+			return nil, err
+		}
+		key.SetUint(value)
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(text, typ.Bits())
+		if err != nil {
+			return nil, err
+		}
+		key.SetFloat(value)
+	default:
+		return nil, fmt.Errorf("cannot parse keys of type %v, set CSVOptions.ParseKey", typ)
+	}
+	return key.Interface(), nil
+}
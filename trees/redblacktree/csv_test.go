@@ -0,0 +1,144 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func TestRedBlackTreeExportCSV(t *testing.T) {
+	tree := NewWithFloat64Comparator()
+	for _, key := range []float64{2.5, -1, 2.5, 10} {
+		tree.Put(key)
+	}
+
+	var buf bytes.Buffer
+	if err := tree.ExportCSV(&buf, CSVOptions{}); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := buf.String(), "-1,1\n2.5,2\n10,1\n"; actualValue != expectedValue {
+		t.Errorf("Got %q expected %q", actualValue, expectedValue)
+	}
+
+	buf.Reset()
+	options := CSVOptions{Comma: ';', Header: true, Cumulative: true, Rank: true}
+	if err := tree.ExportCSV(&buf, options); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := buf.String(), "key;count;cumulative;rank\n-1;1;1;0\n2.5;2;3;1\n10;1;4;3\n"; actualValue != expectedValue {
+		t.Errorf("Got %q expected %q", actualValue, expectedValue)
+	}
+
+	restored := NewWithFloat64Comparator()
+	if err := restored.ImportCSV(&buf, options); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), "[-1 2.5 2.5 10]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeCSVRoundTripTypes(t *testing.T) {
+	now := time.Date(2020, 5, 17, 10, 0, 0, 42, time.UTC)
+	tests := []struct {
+		tree *Tree
+		keys []interface{}
+	}{
+		{NewWithStringComparator(), []interface{}{"a,b", "c\"d", "e\nf"}},
+		{NewWith(utils.Int8Comparator), []interface{}{int8(-128), int8(127)}},
+		{NewWith(utils.UInt64Comparator), []interface{}{uint64(0), uint64(1 << 63)}},
+		{NewWith(utils.Float32Comparator), []interface{}{float32(0.1), float32(-3)}},
+		{NewWith(utils.TimeComparator), []interface{}{now, now.Add(time.Hour)}},
+	}
+	for _, test := range tests {
+		for _, key := range test.keys {
+			test.tree.PutN(key, 3)
+		}
+		var buf bytes.Buffer
+		if err := test.tree.ExportCSV(&buf, CSVOptions{}); err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		restored := NewWith(test.tree.Comparator)
+		if err := restored.ImportCSV(&buf, CSVOptions{}); err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), fmt.Sprintf("%v", test.tree.Keys()); actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+}
+
+func TestRedBlackTreeImportCSV(t *testing.T) {
+	input := "key,count\n3,2\n1,1\n3,4\n2,0\n"
+
+	tree := NewWithIntComparator()
+	err := tree.ImportCSV(strings.NewReader(input), CSVOptions{Header: true})
+	var csvErr *CSVError
+	if !errors.As(err, &csvErr) || csvErr.Line != 4 || !strings.Contains(err.Error(), `duplicate key "3"`) {
+		t.Errorf("Got %v expected duplicate key on line 4", err)
+	}
+
+	if err := tree.ImportCSV(strings.NewReader(input), CSVOptions{Header: true, Lenient: true}); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[1 3 3 3 3 3 3]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	custom := NewWith(func(a, b interface{}) int { return utils.IntComparator(a, b) })
+	parseKey := func(text string) (interface{}, error) { return len(text), nil }
+	if err := custom.ImportCSV(strings.NewReader("aaa,1\nb,2\n"), CSVOptions{ParseKey: parseKey}); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", custom.Keys()), "[1 1 3]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if err := custom.ImportCSV(strings.NewReader("1,1\n"), CSVOptions{}); err != ErrNoKeyType {
+		t.Errorf("Got %v expected %v", err, ErrNoKeyType)
+	}
+	if err := (&Tree{}).ImportCSV(strings.NewReader("1,1\n"), CSVOptions{ParseKey: parseKey}); err == nil {
+		t.Errorf("Expected error for missing comparator")
+	}
+}
+
+func TestRedBlackTreeImportCSVInvalid(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+		err   string
+	}{
+		{"1,1\n2\n", 2, "expected key and count, got 1 fields"},
+		{"1,1\nx,1\n", 2, `invalid key "x"`},
+		{"1,1\n2,-1\n", 2, `invalid count "-1"`},
+		{"1,1\n2,a\n", 2, `invalid count "a"`},
+		{"1,1\n2,\"3\n", 2, "extraneous or missing"},
+		{"\"1\n2\",1\n\"1\n2\",1\n", 3, `duplicate key "1\n2"`},
+		{"1,0\n\n2,1\r\n1,3", 4, `duplicate key "1"`},
+		{"1,1\r\n\r\n1,2\r\n", 3, `duplicate key "1"`},
+	}
+	for _, test := range tests {
+		tree := NewWithIntComparator()
+		tree.Put(42)
+		if strings.Contains(test.err, "duplicate") {
+			tree = NewWithStringComparator()
+			tree.Put("42")
+		}
+		err := tree.ImportCSV(strings.NewReader(test.input), CSVOptions{})
+		var csvErr *CSVError
+		if !errors.As(err, &csvErr) || csvErr.Line != test.line || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Got %v expected %v on line %v", err, test.err, test.line)
+		}
+		if actualValue := tree.Size(); actualValue != 1 {
+			t.Errorf("Got %v expected %v", actualValue, 1)
+		}
+	}
+}
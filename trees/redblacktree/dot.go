@@ -0,0 +1,112 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOTOptions configures WriteDOT.
+type DOTOptions struct {
+	// Name of the graph, "RedBlackTree" if empty.
+	Name string
+	// Highlight, if not nil, highlights the path descending from the root towards this key,
+	// the nodes visited by lookups and counting queries such as CountSmaller.
+	Highlight interface{}
+	// ShowNil draws the nil leaves, which are otherwise invisible and only keep left and right children apart.
+	ShowNil bool
+	// FormatKey formats keys in labels, fmt.Sprint if nil.
+	FormatKey func(key interface{}) string
+}
+
+// WriteDOT writes the structure of the tree as a Graphviz DOT graph, e.g. to be rendered with
+// "dot -Tsvg". Nodes are colored red or black and labeled with their key, multiplicity (NumRepeated+1)
+// and the number of elements in their subtree.
+// Key should adhere to the comparator's type assertion if highlighting, otherwise method panics.
+func (tree *Tree) WriteDOT(w io.Writer, options DOTOptions) error {
+	name := options.Name
+	if name == "" {
+		name = "RedBlackTree"
+	}
+	format := options.FormatKey
+	if format == nil {
+		format = func(key interface{}) string { return fmt.Sprint(key) }
+	}
+	path := make(map[*Node]bool)
+	if options.Highlight != nil {
+		for node := tree.Root; node != nil; {
+			path[node] = true
+			compare := tree.compare(options.Highlight, node.Key)
+			switch {
+			case compare == 0:
+				node = nil
+			case compare < 0:
+				node = node.Left
+			case compare > 0:
+				node = node.Right
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %s {\n", dotQuote(name))
+	bw.WriteString("\tnode [shape=circle, style=filled, fontcolor=white, fontname=\"Helvetica\"];\n")
+	ids := make(map[*Node]int)
+	nils := 0
+	var write func(node *Node)
+	write = func(node *Node) {
+		id := len(ids)
+		ids[node] = id
+		fillColor := "black"
+		if node.color == red {
+			fillColor = "red"
+		}
+		fmt.Fprintf(bw, "\tn%d [label=%s, fillcolor=%s", id,
+			dotQuote(fmt.Sprintf("%s\n×%d size %d", format(node.Key), node.NumRepeated+1, node.size())), fillColor)
+		if path[node] {
+			bw.WriteString(", color=blue, penwidth=3")
+		}
+		bw.WriteString("];\n")
+		if node.Left == nil && node.Right == nil && !options.ShowNil {
+			return
+		}
+		for _, child := range []*Node{node.Left, node.Right} {
+			if child == nil {
+				style := "style=invis"
+				if options.ShowNil {
+					style = "shape=point, fillcolor=black"
+				}
+				fmt.Fprintf(bw, "\tnil%d [label=\"\", %s];\n", nils, style)
+				edgeStyle := ""
+				if !options.ShowNil {
+					edgeStyle = " [style=invis]"
+				}
+				fmt.Fprintf(bw, "\tn%d -> nil%d%s;\n", id, nils, edgeStyle)
+				nils++
+				continue
+			}
+			write(child)
+			fmt.Fprintf(bw, "\tn%d -> n%d", id, ids[child])
+			if path[child] {
+				bw.WriteString(" [color=blue, penwidth=3]")
+			}
+			bw.WriteString(";\n")
+		}
+	}
+	if tree.Root != nil {
+		write(tree.Root)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
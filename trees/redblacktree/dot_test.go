@@ -0,0 +1,52 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedBlackTreeWriteDOT(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{5, 6, 7, 3, 4, 1, 2} {
+		tree.PutN(key, key%3+1)
+	}
+	var buf bytes.Buffer
+	if err := tree.WriteDOT(&buf, DOTOptions{Highlight: 2}); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	golden := filepath.Join("testdata", "tree.dot.golden")
+	if *update {
+		ioutil.WriteFile(golden, buf.Bytes(), 0644)
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue := buf.String(); actualValue != string(expected) {
+		t.Errorf("Got %v expected %v", actualValue, string(expected))
+	}
+
+	buf.Reset()
+	tree = NewWithStringComparator()
+	tree.Put(`say "hi"`)
+	tree.Put("a")
+	tree.WriteDOT(&buf, DOTOptions{Name: "strings", ShowNil: true, FormatKey: func(key interface{}) string { return key.(string) + "!" }})
+	for _, expected := range []string{`digraph "strings" {`, `label="say \"hi\"!\n×1 size 2"`, `label="a!\n×1 size 1", fillcolor=red`, "shape=point"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Got %v expected to contain %v", buf.String(), expected)
+		}
+	}
+
+	buf.Reset()
+	NewWithIntComparator().WriteDOT(&buf, DOTOptions{})
+	if actualValue, expectedValue := buf.String(), "digraph \"RedBlackTree\" {\n\tnode [shape=circle, style=filled, fontcolor=white, fontname=\"Helvetica\"];\n}\n"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
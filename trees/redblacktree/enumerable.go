@@ -0,0 +1,163 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"github.com/afiodorov/countedredblacktree/containers"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func assertEnumerableImplementation() {
+	var _ containers.EnumerableWithKey = EnumerableWithKey{}
+	var _ containers.EnumerableWithIndex = EnumerableWithIndex{}
+}
+
+// EnumerableWithKey enumerates distinct keys of a tree in-order, passing each key with its count.
+type EnumerableWithKey struct {
+	tree *Tree
+}
+
+// EnumerableWithIndex enumerates distinct keys of a tree in-order, passing each key with its rank,
+// i.e. the number of elements smaller than the key.
+type EnumerableWithIndex struct {
+	tree *Tree
+}
+
+// EnumerableWithKey returns the tree's enumerable functions passing (key, count).
+func (tree *Tree) EnumerableWithKey() EnumerableWithKey {
+	return EnumerableWithKey{tree: tree}
+}
+
+// EnumerableWithIndex returns the tree's enumerable functions passing (rank, key).
+func (tree *Tree) EnumerableWithIndex() EnumerableWithIndex {
+	return EnumerableWithIndex{tree: tree}
+}
+
+// Each calls the given function once for each key, passing the key and its count.
+func (enumerable EnumerableWithKey) Each(f func(key interface{}, count interface{})) {
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		f(node.Key, node.NumRepeated+1)
+	}
+}
+
+// Map invokes the given function once for each key and returns a tree with the given comparator
+// containing the returned keys, each repeated the returned number of times.
+// Counts of keys mapped to the same key are summed, non-positive counts are dropped.
+func (enumerable EnumerableWithKey) Map(comparator utils.Comparator, f func(key interface{}, count int) (interface{}, int)) *Tree {
+	newTree := NewWith(comparator)
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		newTree.PutN(f(node.Key, node.NumRepeated+1))
+	}
+	return newTree
+}
+
+// Select returns a new tree with the same comparator containing all keys, with their counts,
+// for which the given function returns a true value.
+func (enumerable EnumerableWithKey) Select(f func(key interface{}, count int) bool) *Tree {
+	newTree := NewWith(enumerable.tree.Comparator)
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		if f(node.Key, node.NumRepeated+1) {
+			newTree.PutN(node.Key, node.NumRepeated+1)
+		}
+	}
+	return newTree
+}
+
+// Any passes each key with its count to the given function and
+// returns true if the function ever returns true for any key.
+func (enumerable EnumerableWithKey) Any(f func(key interface{}, count interface{}) bool) bool {
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		if f(node.Key, node.NumRepeated+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// All passes each key with its count to the given function and
+// returns true if the function returns true for all keys.
+func (enumerable EnumerableWithKey) All(f func(key interface{}, count interface{}) bool) bool {
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		if !f(node.Key, node.NumRepeated+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Find passes each key with its count to the given function and returns
+// the first (key, count) for which the function is true or nil,nil otherwise.
+func (enumerable EnumerableWithKey) Find(f func(key interface{}, count interface{}) bool) (interface{}, interface{}) {
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		if f(node.Key, node.NumRepeated+1) {
+			return node.Key, node.NumRepeated + 1
+		}
+	}
+	return nil, nil
+}
+
+// Each calls the given function once for each key, passing the key's rank and the key.
+func (enumerable EnumerableWithIndex) Each(f func(index int, key interface{})) {
+	rank := 0
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		f(rank, node.Key)
+		rank += node.NumRepeated + 1
+	}
+}
+
+// Map invokes the given function once for each key and returns a tree with the given comparator
+// containing the returned keys, each repeated as many times as the key it was mapped from.
+func (enumerable EnumerableWithIndex) Map(comparator utils.Comparator, f func(index int, key interface{}) interface{}) *Tree {
+	newTree := NewWith(comparator)
+	rank := 0
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		newTree.PutN(f(rank, node.Key), node.NumRepeated+1)
+		rank += node.NumRepeated + 1
+	}
+	return newTree
+}
+
+// Select returns a new tree with the same comparator containing all keys, with their counts,
+// for which the given function returns a true value.
+func (enumerable EnumerableWithIndex) Select(f func(index int, key interface{}) bool) *Tree {
+	newTree := NewWith(enumerable.tree.Comparator)
+	rank := 0
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		if f(rank, node.Key) {
+			newTree.PutN(node.Key, node.NumRepeated+1)
+		}
+		rank += node.NumRepeated + 1
+	}
+	return newTree
+}
+
+// Any passes each key with its rank to the given function and
+// returns true if the function ever returns true for any key.
+func (enumerable EnumerableWithIndex) Any(f func(index int, key interface{}) bool) bool {
+	index, _ := enumerable.Find(f)
+	return index != -1
+}
+
+// All passes each key with its rank to the given function and
+// returns true if the function returns true for all keys.
+func (enumerable EnumerableWithIndex) All(f func(index int, key interface{}) bool) bool {
+	index, _ := enumerable.Find(func(index int, key interface{}) bool {
+		return !f(index, key)
+	})
+	return index == -1
+}
+
+// Find passes each key with its rank to the given function and returns
+// the first (rank, key) for which the function is true or -1,nil otherwise.
+func (enumerable EnumerableWithIndex) Find(f func(index int, key interface{}) bool) (int, interface{}) {
+	rank := 0
+	for node := enumerable.tree.Left(); node != nil; node = node.successor() {
+		if f(rank, node.Key) {
+			return rank, node.Key
+		}
+		rank += node.NumRepeated + 1
+	}
+	return -1, nil
+}
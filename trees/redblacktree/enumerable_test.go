@@ -0,0 +1,106 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func TestRedBlackTreeEnumerableWithKey(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{3, 1, 2, 2, 4, 4, 4} {
+		tree.Put(key)
+	}
+	enumerable := tree.EnumerableWithKey()
+
+	var pairs []string
+	enumerable.Each(func(key interface{}, count interface{}) {
+		pairs = append(pairs, fmt.Sprintf("%v:%v", key, count))
+	})
+	if actualValue, expectedValue := fmt.Sprintf("%v", pairs), "[1:1 2:2 3:1 4:3]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	if !enumerable.Any(func(key interface{}, count interface{}) bool { return count.(int) == 3 }) {
+		t.Errorf("Got %v expected %v", false, true)
+	}
+	if enumerable.Any(func(key interface{}, count interface{}) bool { return count.(int) > 3 }) {
+		t.Errorf("Got %v expected %v", true, false)
+	}
+	if !enumerable.All(func(key interface{}, count interface{}) bool { return count.(int) > 0 }) {
+		t.Errorf("Got %v expected %v", false, true)
+	}
+	if enumerable.All(func(key interface{}, count interface{}) bool { return count.(int) == 1 }) {
+		t.Errorf("Got %v expected %v", true, false)
+	}
+	if key, count := enumerable.Find(func(key interface{}, count interface{}) bool { return count.(int) == 2 }); key != 2 || count != 2 {
+		t.Errorf("Got %v,%v expected %v,%v", key, count, 2, 2)
+	}
+	if key, count := enumerable.Find(func(key interface{}, count interface{}) bool { return false }); key != nil || count != nil {
+		t.Errorf("Got %v,%v expected %v,%v", key, count, nil, nil)
+	}
+
+	selected := enumerable.Select(func(key interface{}, count int) bool { return count > 1 })
+	if actualValue, expectedValue := fmt.Sprintf("%v", selected.Keys()), "[2 2 4 4 4]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	mapped := enumerable.Map(utils.StringComparator, func(key interface{}, count int) (interface{}, int) {
+		return fmt.Sprintf("k%d", key.(int)%2), count - 1
+	})
+	if actualValue, expectedValue := fmt.Sprintf("%v", mapped.Keys()), "[k0 k0 k0]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeEnumerableWithIndex(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{3, 1, 2, 2, 4, 4, 4} {
+		tree.Put(key)
+	}
+	enumerable := tree.EnumerableWithIndex()
+
+	var pairs []string
+	enumerable.Each(func(index int, key interface{}) {
+		pairs = append(pairs, fmt.Sprintf("%v:%v", index, key))
+	})
+	if actualValue, expectedValue := fmt.Sprintf("%v", pairs), "[0:1 1:2 3:3 4:4]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	if !enumerable.Any(func(index int, key interface{}) bool { return index == 3 }) {
+		t.Errorf("Got %v expected %v", false, true)
+	}
+	if enumerable.Any(func(index int, key interface{}) bool { return index == 2 }) {
+		t.Errorf("Got %v expected %v", true, false)
+	}
+	if !enumerable.All(func(index int, key interface{}) bool { return index <= key.(int) }) {
+		t.Errorf("Got %v expected %v", false, true)
+	}
+	if enumerable.All(func(index int, key interface{}) bool { return index == 0 }) {
+		t.Errorf("Got %v expected %v", true, false)
+	}
+	if index, key := enumerable.Find(func(index int, key interface{}) bool { return key.(int) > 2 }); index != 3 || key != 3 {
+		t.Errorf("Got %v,%v expected %v,%v", index, key, 3, 3)
+	}
+	if index, key := enumerable.Find(func(index int, key interface{}) bool { return false }); index != -1 || key != nil {
+		t.Errorf("Got %v,%v expected %v,%v", index, key, -1, nil)
+	}
+
+	selected := enumerable.Select(func(index int, key interface{}) bool { return index >= 3 })
+	if actualValue, expectedValue := fmt.Sprintf("%v", selected.Keys()), "[3 4 4 4]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	mapped := enumerable.Map(utils.IntComparator, func(index int, key interface{}) interface{} {
+		return -key.(int)
+	})
+	if actualValue, expectedValue := fmt.Sprintf("%v", mapped.Keys()), "[-4 -4 -4 -3 -2 -2 -1]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
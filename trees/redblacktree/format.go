@@ -0,0 +1,113 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+func assertFormatterImplementation() {
+	var _ fmt.Formatter = (*Tree)(nil)
+}
+
+// Format implements fmt.Formatter.
+//
+//	%v   the sorted multiset with the count of every key, e.g. {1:3 2:1 5:2}
+//	%+v  the structure of the tree, every node with its count, subtree size and color
+//	%#v  Go code constructing the tree
+//	%s   String
+//
+// A precision truncates large trees: %.10v and %#.10v print the first 10 distinct keys,
+// %+.3v prints the nodes up to depth 3.
+func (tree *Tree) Format(f fmt.State, verb rune) {
+	limit, truncate := f.Precision()
+	if !truncate {
+		limit = -1
+	}
+	var b strings.Builder
+	switch {
+	case verb == 'v' && f.Flag('#'):
+		tree.formatGo(&b, limit)
+	case verb == 'v' && f.Flag('+'):
+		b.WriteString("RedBlackTree\n")
+		if tree.Root != nil {
+			output(tree.Root, "", true, &b, formatNode, limit)
+		}
+	case verb == 'v':
+		tree.formatEntries(&b, limit)
+	case verb == 's':
+		b.WriteString(tree.String())
+	default:
+		fmt.Fprintf(&b, "%%!%c(*redblacktree.Tree=%p)", verb, tree)
+	}
+	f.Write([]byte(b.String()))
+}
+
+// formatEntries writes the first limit distinct keys with their counts, all if limit is negative.
+func (tree *Tree) formatEntries(b *strings.Builder, limit int) {
+	b.WriteString("{")
+	for node, i := tree.Left(), 0; node != nil; node, i = node.successor(), i+1 {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		if i == limit {
+			b.WriteString("…")
+			break
+		}
+		fmt.Fprintf(b, "%v:%d", node.Key, node.NumRepeated+1)
+	}
+	b.WriteString("}")
+}
+
+// formatNode labels a node with its key, count, subtree size and color.
+func formatNode(node *Node) string {
+	color := "black"
+	if node.color == red {
+		color = "red"
+	}
+	return fmt.Sprintf("%v ×%d size %d %s", node.Key, node.NumRepeated+1, node.size(), color)
+}
+
+// formatGo writes a function literal constructing the tree with its first limit distinct keys,
+// all if limit is negative.
+func (tree *Tree) formatGo(b *strings.Builder, limit int) {
+	b.WriteString("func() *redblacktree.Tree {\n")
+	fmt.Fprintf(b, "\ttree := redblacktree.NewWith(%s)\n", goComparator(tree.Comparator))
+	remaining := tree.distinct()
+	for node := tree.Left(); node != nil && limit != 0; node = node.successor() {
+		fmt.Fprintf(b, "\ttree.PutN(%s, %d)\n", goKey(node.Key), node.NumRepeated+1)
+		remaining--
+		limit--
+	}
+	if remaining > 0 {
+		fmt.Fprintf(b, "\t// … %d more keys\n", remaining)
+	}
+	b.WriteString("\treturn tree\n}()")
+}
+
+// goComparator returns the qualified name of a named comparator function.
+func goComparator(comparator interface{}) string {
+	if comparator == nil || reflect.ValueOf(comparator).IsNil() {
+		return "nil"
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(comparator).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	if strings.Contains(name, ".func") {
+		return "nil /* anonymous comparator */"
+	}
+	return name
+}
+
+// goKey returns a Go expression of the key with its dynamic type, untyped constants being int or string.
+func goKey(key interface{}) string {
+	switch key.(type) {
+	case int, string:
+		return fmt.Sprintf("%#v", key)
+	}
+	return fmt.Sprintf("%T(%#v)", key, key)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedBlackTreeFormat(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{5, 6, 7, 3, 4, 1, 2} {
+		tree.PutN(key, key%3+1)
+	}
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"%v", "{1:2 2:3 3:1 4:2 5:3 6:1 7:2}"},
+		{"%.3v", "{1:2 2:3 3:1 …}"},
+		{"%.0v", "{…}"},
+		{"%+v", "RedBlackTree\n" +
+			"│   ┌── 7 ×2 size 2 black\n" +
+			"└── 6 ×1 size 14 black\n" +
+			"    │   ┌── 5 ×3 size 3 black\n" +
+			"    └── 4 ×2 size 11 red\n" +
+			"        │   ┌── 3 ×1 size 1 red\n" +
+			"        └── 2 ×3 size 6 black\n" +
+			"            └── 1 ×2 size 2 red\n"},
+		{"%+.2v", "RedBlackTree\n" +
+			"│   ┌── 7 ×2 size 2 black\n" +
+			"└── 6 ×1 size 14 black\n" +
+			"    │   ┌── …\n" +
+			"    └── 4 ×2 size 11 red\n" +
+			"        └── …\n"},
+		{"%#.2v", "func() *redblacktree.Tree {\n" +
+			"\ttree := redblacktree.NewWith(utils.IntComparator)\n" +
+			"\ttree.PutN(1, 2)\n" +
+			"\ttree.PutN(2, 3)\n" +
+			"\t// … 5 more keys\n" +
+			"\treturn tree\n}()"},
+		{"%s", tree.String()},
+		{"%d", fmt.Sprintf("%%!d(*redblacktree.Tree=%p)", tree)},
+	}
+	for _, test := range tests {
+		if actualValue := fmt.Sprintf(test.format, tree); actualValue != test.expected {
+			t.Errorf("%v: Got %v expected %v", test.format, actualValue, test.expected)
+		}
+	}
+
+	if actualValue, expectedValue := fmt.Sprintf("%v %+v", NewWithIntComparator(), NewWithIntComparator()), "{} RedBlackTree\n"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	floats := NewWithFloat64Comparator()
+	floats.PutN(1.0, 2)
+	strs := NewWith(func(a, b interface{}) int { return strings.Compare(a.(string), b.(string)) })
+	strs.Put(`a "quoted" key`)
+	for tree, expected := range map[*Tree]string{
+		floats: "tree := redblacktree.NewWith(utils.Float64Comparator)\n\ttree.PutN(float64(1), 2)\n",
+		strs:   "tree := redblacktree.NewWith(nil /* anonymous comparator */)\n\ttree.PutN(\"a \\\"quoted\\\" key\", 1)\n",
+	} {
+		if actualValue := fmt.Sprintf("%#v", tree); !strings.Contains(actualValue, expected) {
+			t.Errorf("Got %v expected to contain %v", actualValue, expected)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func assertGobImplementation() {
+	var _ gob.GobEncoder = (*Tree)(nil)
+	var _ gob.GobDecoder = (*Tree)(nil)
+}
+
+const (
+	gobBinary byte = 0 // binary format, see MarshalBinary
+	gobKeys   byte = 1 // gob encoded gobEntries
+)
+
+// gobEntries holds the in-order content of a tree whose comparator has no registered key type.
+type gobEntries struct {
+	Keys   []interface{}
+	Counts []int
+}
+
+// GobEncode implements gob.GobEncoder, encoding the in-order (key, count) sequence of the tree.
+//
+// If the tree's comparator is registered with utils.RegisterKeyType the binary format is used,
+// which records the key type name so the decoder restores the comparator.
+// Otherwise keys are gob encoded as interface values, so their concrete types must be
+// registered with gob.Register and the decoding tree must already have a comparator.
+func (tree *Tree) GobEncode() ([]byte, error) {
+	if _, found := utils.KeyTypeOf(tree.Comparator); found {
+		var buf bytes.Buffer
+		buf.WriteByte(gobBinary)
+		err := tree.writeBinary(&buf, nil)
+		return buf.Bytes(), err
+	}
+	var entries gobEntries
+	for node := tree.Left(); node != nil; node = node.successor() {
+		entries.Keys = append(entries.Keys, node.Key)
+		entries.Counts = append(entries.Counts, node.NumRepeated+1)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(gobKeys)
+	err := gob.NewEncoder(&buf).Encode(&entries)
+	return buf.Bytes(), err
+}
+
+// GobDecode implements gob.GobDecoder, see GobEncode. On error the tree is left unchanged.
+func (tree *Tree) GobDecode(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("redblacktree: empty gob data")
+	}
+	switch data[0] {
+	case gobBinary:
+		return tree.UnmarshalBinary(data[1:])
+	case gobKeys:
+		if tree.Comparator == nil {
+			return errors.New("redblacktree: decoding gob keys of unregistered key type requires a comparator")
+		}
+		var entries gobEntries
+		if err := gob.NewDecoder(bytes.NewReader(data[1:])).Decode(&entries); err != nil {
+			return err
+		}
+		if len(entries.Keys) != len(entries.Counts) {
+			return fmt.Errorf("redblacktree: %d gob keys but %d counts", len(entries.Keys), len(entries.Counts))
+		}
+		newTree := NewWith(tree.Comparator)
+		index := 0
+		err := newTree.buildSorted(len(entries.Keys), func() (Entry, error) {
+			index++
+			return Entry{Key: entries.Keys[index-1], Count: entries.Counts[index-1]}, nil
+		})
+		if err != nil {
+			return err
+		}
+		tree.replaceWith(newTree)
+		return nil
+	}
+	return fmt.Errorf("redblacktree: unknown gob encoding %d", data[0])
+}
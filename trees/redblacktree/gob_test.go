@@ -0,0 +1,102 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func TestRedBlackTreeGobRegisteredKeyType(t *testing.T) {
+	type state struct {
+		Name  string
+		Times *Tree
+		Ints  Tree
+	}
+	now := time.Date(2020, 5, 17, 10, 0, 0, 0, time.UTC)
+	in := state{Name: "s", Times: NewWith(utils.TimeComparator), Ints: *NewWithIntComparator()}
+	in.Times.Put(now)
+	in.Times.Put(now.Add(-time.Minute))
+	in.Times.Put(now)
+	for _, key := range []int{5, 1, 5, 3} {
+		in.Ints.Put(key)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&in); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	var out state
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	assertValidTree(t, out.Times)
+	assertValidTree(t, &out.Ints)
+	if actualValue, expectedValue := fmt.Sprintf("%v", out.Times.Keys()), fmt.Sprintf("%v", in.Times.Keys()); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v %v", out.Ints.Keys(), out.Ints.Size()), "[1 3 5 5] 4"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if actualValue, expectedValue := out.Ints.CountGreater(3), 2; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+type gobTestKey struct {
+	A, B int
+}
+
+func gobTestKeyComparator(a, b interface{}) int {
+	x, y := a.(gobTestKey), b.(gobTestKey)
+	if c := utils.IntComparator(x.A, y.A); c != 0 {
+		return c
+	}
+	return utils.IntComparator(x.B, y.B)
+}
+
+func TestRedBlackTreeGobUnregisteredKeyType(t *testing.T) {
+	gob.Register(gobTestKey{})
+	tree := NewWith(gobTestKeyComparator)
+	for _, key := range []gobTestKey{{2, 1}, {1, 5}, {2, 1}, {1, 2}} {
+		tree.Put(key)
+	}
+	data, err := tree.GobEncode()
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+
+	if err := (&Tree{}).GobDecode(data); err == nil || !strings.Contains(err.Error(), "requires a comparator") {
+		t.Errorf("Got %v expected missing comparator error", err)
+	}
+
+	restored := NewWith(gobTestKeyComparator)
+	if err := restored.GobDecode(data); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	assertValidTree(t, restored)
+	if actualValue, expectedValue := fmt.Sprintf("%v %v", restored.Keys(), restored.Size()), "[{1 2} {1 5} {2 1} {2 1}] 4"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeGobInvalid(t *testing.T) {
+	tree := NewWithIntComparator()
+	tree.Put(1)
+	for _, data := range [][]byte{nil, {7}, {gobBinary, 'X'}, {gobKeys, 0xff}} {
+		if err := tree.GobDecode(data); err == nil {
+			t.Errorf("Expected error for %x", data)
+		}
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[1]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// reconcileLeafSize is the number of elements below which Reconcile compares entries instead of splitting ranges.
+const reconcileLeafSize = 32
+
+// ErrHashingDisabled is returned when reconciling a tree without hashing, see EnableHashing.
+var ErrHashingDisabled = errors.New("redblacktree: hashing is not enabled")
+
+// EntryHash hashes a key together with its count.
+type EntryHash func(key interface{}, count int) uint64
+
+// EnableHashing maintains the hash of every subtree's keys and counts, the sum of the hashes of its entries.
+// Sums do not depend on the shape of the tree, so trees holding the same multiset have the same hashes over
+// the same key ranges whatever the order of insertion, see RangeHash and Reconcile.
+// The hash of any key range is such an additive sum rather than the hash of fixed key-range buckets,
+// so ranges are chosen by the caller and split at median keys.
+//
+// Trees without hashing neither store nor update hashes.
+//
+// If hash is nil, entries are hashed from their encoding with the codec registered for the tree's comparator,
+// see utils.RegisterKeyType, which returns ErrNoKeyType if there is none.
+// Trees compared with each other must use the same hash. Enabling hashing takes O(n).
+func (tree *Tree) EnableHashing(hash EntryHash) error {
+	if hash == nil {
+		keyType, found := utils.KeyTypeOf(tree.Comparator)
+		if !found {
+			return ErrNoKeyType
+		}
+		hash = codecEntryHash(keyType.Codec)
+	}
+	tree.hasher = hash
+	tree.rehash(tree.Root)
+	return nil
+}
+
+// DisableHashing stops maintaining hashes and releases them.
+func (tree *Tree) DisableHashing() {
+	tree.hasher = nil
+	tree.rehash(tree.Root)
+}
+
+// codecEntryHash hashes the FNV-1a hash of the key's encoding mixed with its count.
+func codecEntryHash(codec utils.KeyCodec) EntryHash {
+	return func(key interface{}, count int) uint64 {
+		data, err := codec.Encode(key)
+		if err != nil {
+			panic(fmt.Sprintf("redblacktree: cannot hash key %v: %v", key, err))
+		}
+		h := fnv.New64a()
+		h.Write(data)
+		return mix64(h.Sum64() + mix64(uint64(count)))
+	}
+}
+
+// mix64 is the finalizer of SplitMix64, spreading every input bit over the output.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// nodeHashes holds the hashes of a node while hashing is enabled.
+type nodeHashes struct {
+	hash      uint64 // hash of the node's key and count
+	childHash uint64 // sum of the hashes in the node's subtrees
+}
+
+// newNodeHashes returns the hashes of a new node holding the entry, nil if hashing is disabled.
+func (tree *Tree) newNodeHashes(key interface{}, count int) *nodeHashes {
+	if tree.hasher == nil {
+		return nil
+	}
+	return &nodeHashes{hash: tree.hasher(key, count)}
+}
+
+// updateHash rehashes the node's entry after its count changed.
+func (tree *Tree) updateHash(node *Node) {
+	if node.hashes != nil {
+		node.hashes.hash = tree.hasher(node.Key, node.NumRepeated+1)
+	}
+}
+
+// rehash recomputes the hashes in the subtree rooted at node, removing them if hashing is disabled.
+func (tree *Tree) rehash(node *Node) uint64 {
+	if node == nil {
+		return 0
+	}
+	if tree.hasher == nil {
+		node.hashes = nil
+		tree.rehash(node.Left)
+		tree.rehash(node.Right)
+		return 0
+	}
+	node.hashes = &nodeHashes{hash: tree.hasher(node.Key, node.NumRepeated+1)}
+	node.hashes.childHash = tree.rehash(node.Left) + tree.rehash(node.Right)
+	return node.subtreeHash()
+}
+
+// subtreeHash returns the sum of the hashes in the subtree rooted at the node.
+func (node *Node) subtreeHash() uint64 {
+	if node == nil || node.hashes == nil {
+		return 0
+	}
+	return node.hashes.hash + node.hashes.childHash
+}
+
+// RangeHash returns the sum of the hashes of the entries with lo <= key < hi in O(log n).
+// A nil bound leaves that side unbounded. It is zero unless hashing is enabled, see EnableHashing.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (tree *Tree) RangeHash(lo, hi interface{}) uint64 {
+	if tree.hasher == nil {
+		return 0
+	}
+	sum := tree.Root.subtreeHash()
+	if hi != nil {
+		sum = tree.hashBefore(hi)
+	}
+	if lo != nil {
+		sum -= tree.hashBefore(lo)
+	}
+	return sum
+}
+
+// hashBefore returns the sum of the hashes of the entries smaller than key.
+func (tree *Tree) hashBefore(key interface{}) (sum uint64) {
+	node := tree.Root
+	for node != nil {
+		compare := tree.compare(key, node.Key)
+		switch {
+		case compare == 0:
+			return sum + node.Left.subtreeHash()
+		case compare < 0:
+			node = node.Left
+		case compare > 0:
+			sum += node.Left.subtreeHash() + node.hashes.hash
+			node = node.Right
+		}
+	}
+	return sum
+}
+
+// Digest summarizes the entries with lo <= key < hi for Reconcile.
+type Digest struct {
+	Hash uint64 // sum of the hashes of the entries, see RangeHash
+	Size int    // number of elements counting repetitions
+	// Median is a key within the range splitting it into two non-empty ranges,
+	// nil if the range holds fewer than two distinct keys.
+	Median interface{}
+}
+
+// Digest returns the digest of the entries with lo <= key < hi in O(log n).
+// A nil bound leaves that side unbounded.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (tree *Tree) Digest(lo, hi interface{}) Digest {
+	start, end := 0, tree.Size()
+	if lo != nil {
+		start = tree.CountSmaller(lo)
+	}
+	if hi != nil {
+		end = tree.CountSmaller(hi)
+	}
+	digest := Digest{Hash: tree.RangeHash(lo, hi)}
+	if end <= start {
+		return digest
+	}
+	digest.Size = end - start
+	node, first := tree.selectNode(start + digest.Size/2)
+	if first <= start {
+		// the middle element belongs to the first key of the range
+		if node = node.successor(); node == nil || hi != nil && tree.compare(node.Key, hi) >= 0 {
+			return digest
+		}
+	}
+	digest.Median = node.Key
+	return digest
+}
+
+// RangeEntries returns the entries with lo <= key < hi in-order.
+// A nil bound leaves that side unbounded.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (tree *Tree) RangeEntries(lo, hi interface{}) []Entry {
+	var entries []Entry
+	node := tree.Left()
+	if lo != nil {
+		node, _ = tree.Ceiling(lo)
+	}
+	for ; node != nil && (hi == nil || tree.compare(node.Key, hi) < 0); node = node.successor() {
+		entries = append(entries, Entry{Key: node.Key, Count: node.NumRepeated + 1})
+	}
+	return entries
+}
+
+// Peer is the other side of a reconciliation, typically a tree in another process reached over the network.
+// Its methods return the tree's Digest and RangeEntries for the same range, with a nil bound leaving
+// that side unbounded.
+type Peer interface {
+	Digest(lo, hi interface{}) (Digest, error)
+	RangeEntries(lo, hi interface{}) ([]Entry, error)
+}
+
+// Difference is a key whose count differs between a tree and its peer, a count is zero if the key is missing.
+type Difference struct {
+	Key       interface{}
+	Count     int
+	PeerCount int
+}
+
+// Reconcile returns the keys whose counts differ between the tree and the peer in-order.
+// It compares the digests of both sides, starting with the whole key range, and splits only differing
+// ranges at the median key of the larger side, so the number of requests grows with the number of
+// differences times log n rather than with the size of the trees.
+// Both sides must enable hashing with the same EntryHash.
+func (tree *Tree) Reconcile(peer Peer) ([]Difference, error) {
+	if tree.hasher == nil {
+		return nil, ErrHashingDisabled
+	}
+	var differences []Difference
+	var reconcile func(lo, hi interface{}) error
+	reconcile = func(lo, hi interface{}) error {
+		local := tree.Digest(lo, hi)
+		remote, err := peer.Digest(lo, hi)
+		if err != nil {
+			return err
+		}
+		if local.Hash == remote.Hash && local.Size == remote.Size {
+			return nil
+		}
+		localLeaf := local.Median == nil || local.Size <= reconcileLeafSize
+		remoteLeaf := remote.Median == nil || remote.Size <= reconcileLeafSize
+		if localLeaf && remoteLeaf {
+			entries, err := peer.RangeEntries(lo, hi)
+			if err != nil {
+				return err
+			}
+			differences = tree.diffEntries(differences, tree.RangeEntries(lo, hi), entries)
+			return nil
+		}
+		median := local.Median
+		if localLeaf || !remoteLeaf && remote.Size > local.Size {
+			median = remote.Median
+		}
+		if err := reconcile(lo, median); err != nil {
+			return err
+		}
+		return reconcile(median, hi)
+	}
+	if err := reconcile(nil, nil); err != nil {
+		return nil, err
+	}
+	return differences, nil
+}
+
+// Diff returns the keys whose counts differ between the tree and other in-order, see Reconcile.
+// Both trees must enable hashing with the same EntryHash.
+func (tree *Tree) Diff(other *Tree) ([]Difference, error) {
+	if other.hasher == nil {
+		return nil, ErrHashingDisabled
+	}
+	return tree.Reconcile(treePeer{other})
+}
+
+// treePeer is a Peer in the same process.
+type treePeer struct {
+	tree *Tree
+}
+
+func (peer treePeer) Digest(lo, hi interface{}) (Digest, error) {
+	return peer.tree.Digest(lo, hi), nil
+}
+
+func (peer treePeer) RangeEntries(lo, hi interface{}) ([]Entry, error) {
+	return peer.tree.RangeEntries(lo, hi), nil
+}
+
+// diffEntries appends the differences between two in-order entry lists.
+func (tree *Tree) diffEntries(differences []Difference, local, remote []Entry) []Difference {
+	for len(local) > 0 || len(remote) > 0 {
+		compare := 0
+		switch {
+		case len(local) == 0:
+			compare = 1
+		case len(remote) == 0:
+			compare = -1
+		default:
+			compare = tree.compare(local[0].Key, remote[0].Key)
+		}
+		switch {
+		case compare < 0:
+			differences = append(differences, Difference{Key: local[0].Key, Count: local[0].Count})
+			local = local[1:]
+		case compare > 0:
+			differences = append(differences, Difference{Key: remote[0].Key, PeerCount: remote[0].Count})
+			remote = remote[1:]
+		default:
+			if local[0].Count != remote[0].Count {
+				differences = append(differences, Difference{Key: local[0].Key, Count: local[0].Count, PeerCount: remote[0].Count})
+			}
+			local, remote = local[1:], remote[1:]
+		}
+	}
+	return differences
+}
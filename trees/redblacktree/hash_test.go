@@ -0,0 +1,162 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// assertHashes checks the hashes maintained in every node of a tree with hashing enabled.
+func assertHashes(t *testing.T, tree *Tree) {
+	t.Helper()
+	var check func(node *Node) uint64
+	check = func(node *Node) uint64 {
+		if node == nil {
+			return 0
+		}
+		if expected := tree.hasher(node.Key, node.NumRepeated+1); node.hashes.hash != expected {
+			t.Fatalf("Got hash %v for %v expected %v", node.hashes.hash, node.Key, expected)
+		}
+		if expected := check(node.Left) + check(node.Right); node.hashes.childHash != expected {
+			t.Fatalf("Got child hash %v for %v expected %v", node.hashes.childHash, node.Key, expected)
+		}
+		return node.subtreeHash()
+	}
+	check(tree.Root)
+}
+
+// countingPeer counts the requests to a peer.
+type countingPeer struct {
+	Peer
+	requests int
+}
+
+func (peer *countingPeer) Digest(lo, hi interface{}) (Digest, error) {
+	peer.requests++
+	return peer.Peer.Digest(lo, hi)
+}
+
+func (peer *countingPeer) RangeEntries(lo, hi interface{}) ([]Entry, error) {
+	peer.requests++
+	return peer.Peer.RangeEntries(lo, hi)
+}
+
+func TestRedBlackTreeHashing(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	a, b := NewWithIntComparator(), NewWithIntComparator()
+	a.EnableHashing(nil)
+	keys := r.Perm(500)
+	for _, key := range keys {
+		a.PutN(key, key%3+1)
+		a.Remove(r.Intn(500))
+		a.Put(r.Intn(500))
+	}
+	for _, node := range a.RangeEntries(nil, nil) {
+		b.PutN(node.Key, node.Count)
+	}
+	assertHashes(t, a)
+	if err := b.EnableHashing(nil); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	assertHashes(t, b)
+	if actualValue, expectedValue := a.RangeHash(nil, nil), b.RangeHash(nil, nil); actualValue != expectedValue || actualValue == 0 {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	for i := 0; i < 100; i++ {
+		lo, hi := r.Intn(520)-10, r.Intn(520)-10
+		var expectedValue uint64
+		for _, entry := range a.RangeEntries(lo, hi) {
+			expectedValue += a.hasher(entry.Key, entry.Count)
+		}
+		if lo > hi {
+			expectedValue = -a.RangeHash(hi, lo)
+		}
+		if actualValue := a.RangeHash(lo, hi); actualValue != expectedValue {
+			t.Errorf("RangeHash(%v, %v): Got %v expected %v", lo, hi, actualValue, expectedValue)
+		}
+	}
+
+	data, _ := a.MarshalBinary()
+	b.UnmarshalBinary(data)
+	assertHashes(t, b)
+	b.DisableHashing()
+	if actualValue := b.RangeHash(nil, nil); actualValue != 0 {
+		t.Errorf("Got %v expected %v", actualValue, 0)
+	}
+	b.Put(1000)
+	for node := b.Left(); node != nil; node = node.successor() {
+		if node.hashes != nil {
+			t.Fatalf("Got hashes for %v with hashing disabled", node.Key)
+		}
+	}
+	if _, err := b.Reconcile(treePeer{a}); err != ErrHashingDisabled {
+		t.Errorf("Got %v expected %v", err, ErrHashingDisabled)
+	}
+	if err := NewWith(func(a, b interface{}) int { return 0 }).EnableHashing(nil); err != ErrNoKeyType {
+		t.Errorf("Got %v expected %v", err, ErrNoKeyType)
+	}
+}
+
+func TestRedBlackTreeDigest(t *testing.T) {
+	tree := NewWithIntComparator()
+	tree.EnableHashing(nil)
+	tree.PutN(1, 100)
+	tree.Put(2)
+	tree.PutN(3, 5)
+	tests := []struct {
+		lo, hi interface{}
+		size   int
+		median interface{}
+	}{
+		{nil, nil, 106, 2},
+		{nil, 2, 100, nil},
+		{2, nil, 6, 3},
+		{3, nil, 5, nil},
+		{4, nil, 0, nil},
+		{3, 1, 0, nil},
+	}
+	for _, test := range tests {
+		digest := tree.Digest(test.lo, test.hi)
+		if digest.Size != test.size || digest.Median != test.median {
+			t.Errorf("Digest(%v, %v): Got %v %v expected %v %v", test.lo, test.hi, digest.Size, digest.Median, test.size, test.median)
+		}
+	}
+}
+
+func TestRedBlackTreeDiff(t *testing.T) {
+	a, b := NewWithIntComparator(), NewWithIntComparator()
+	a.EnableHashing(nil)
+	b.EnableHashing(nil)
+	for i := 0; i < 10000; i++ {
+		a.PutN(i, i%7+1)
+	}
+	for i := 9999; i >= 0; i-- {
+		b.PutN(i, i%7+1)
+	}
+	if differences, err := a.Diff(b); len(differences) != 0 || err != nil {
+		t.Errorf("Got %v %v expected no differences", differences, err)
+	}
+
+	a.Remove(10)
+	b.Remove(500)
+	b.Put(-1)
+	for i := 0; i < 7; i++ {
+		a.Remove(7777)
+	}
+	peer := &countingPeer{Peer: treePeer{b}}
+	differences, err := a.Reconcile(peer)
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := "[{-1 0 1} {10 3 4} {500 4 3} {7777 0 1}]"
+	if actualValue := fmt.Sprintf("%v", differences); actualValue != expected {
+		t.Errorf("Got %v expected %v", actualValue, expected)
+	}
+	if peer.requests > 200 {
+		t.Errorf("Got %v requests expected to descend only into differing ranges", peer.requests)
+	}
+}
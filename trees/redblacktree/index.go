@@ -0,0 +1,439 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree/internal/wire"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// The index file format is
+//
+//	magic    "CRBTINDX"
+//	version  byte
+//	keyType  uvarint length followed by the name of the key type, see utils.RegisterKeyType
+//	encoding byte, binaryKeysCodec or binaryKeysDelta
+//	blocks   in-order entries as in MarshalBinary, delta encoding restarting in every block
+//	index    per block its uvarint offset, length, number of entries, number of elements
+//	         before the block and its uint32 little-endian CRC-32C, followed by its first key
+//	         as uvarint length and codec encoding
+//	footer   uint64 little-endian offset and length of the index, number of blocks, distinct keys
+//	         and elements, uint32 little-endian CRC-32C of the index and the magic
+//
+// The index is read into memory when opening, so every query reads a single block.
+const (
+	indexMagic      = "CRBTINDX"
+	indexVersion    = 1
+	indexFooterSize = 5*8 + 4 + 8 // five uint64, the checksum and the magic
+
+	defaultIndexBlockSize = 64
+)
+
+// Errors reported by OpenIndex and the queries of an Index wrapped in an *IndexError.
+var (
+	ErrIndexFormat  = errors.New("not an index or unsupported version")
+	ErrIndexCorrupt = errors.New("index corrupt")
+)
+
+// IndexError records the block of an index an error occurred with.
+// Use errors.Is to check for ErrIndexFormat or ErrIndexCorrupt.
+type IndexError struct {
+	Block int // -1 if the error is not specific to a block
+	Err   error
+}
+
+func (e *IndexError) Error() string {
+	if e.Block < 0 {
+		return "redblacktree: " + e.Err.Error()
+	}
+	return "redblacktree: block " + strconv.Itoa(e.Block) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *IndexError) Unwrap() error {
+	return e.Err
+}
+
+// indexCorrupt returns an *IndexError wrapping ErrIndexCorrupt with the formatted details.
+func indexCorrupt(block int, format string, args ...interface{}) error {
+	return &IndexError{Block: block, Err: fmt.Errorf("%w: "+format, append([]interface{}{ErrIndexCorrupt}, args...)...)}
+}
+
+// IndexOptions configures WriteIndex.
+type IndexOptions struct {
+	// BlockSize is the number of distinct keys per block, 64 if zero.
+	// Larger blocks make the in-memory index smaller and queries read more.
+	BlockSize int
+}
+
+// WriteIndex writes the tree as an immutable index to be queried with OpenIndex without loading it.
+// The tree's comparator must be registered with utils.RegisterKeyType.
+// Returns the number of bytes written.
+func (tree *Tree) WriteIndex(w io.Writer, options IndexOptions) (int64, error) {
+	keyType, found := utils.KeyTypeOf(tree.Comparator)
+	if !found {
+		return 0, ErrNoKeyType
+	}
+	blockSize := options.BlockSize
+	if blockSize <= 0 {
+		blockSize = defaultIndexBlockSize
+	}
+	cw := &countingWriter{w: w}
+	out := &wire.Writer{W: cw}
+	keyEncoding := tree.keyEncoding(keyType.Codec)
+	out.Write([]byte(indexMagic))
+	out.Write([]byte{indexVersion})
+	out.WriteBytes([]byte(keyType.Name))
+	out.Write([]byte{keyEncoding})
+
+	var block, index bytes.Buffer
+	ib := &wire.Writer{W: &index}
+	var blocks, distinct, size uint64
+	node := tree.Left()
+	for node != nil && out.Err == nil {
+		block.Reset()
+		encoder := entryEncoder{bw: &wire.Writer{W: &block}, codec: keyType.Codec, keyEncoding: keyEncoding}
+		first, err := keyType.Codec.Encode(node.Key)
+		if err != nil {
+			return cw.n, err
+		}
+		before, entries := size, 0
+		for ; node != nil && entries < blockSize; node = node.successor() {
+			count := node.NumRepeated + 1
+			encoder.encode(Entry{Key: node.Key, Count: count})
+			entries++
+			size += uint64(count)
+		}
+		if encoder.bw.Err != nil {
+			return cw.n, encoder.bw.Err
+		}
+		ib.WriteUvarint(uint64(cw.n))
+		ib.WriteUvarint(uint64(block.Len()))
+		ib.WriteUvarint(uint64(entries))
+		ib.WriteUvarint(before)
+		var crc [4]byte
+		binary.LittleEndian.PutUint32(crc[:], crc32.Checksum(block.Bytes(), castagnoli))
+		ib.Write(crc[:])
+		ib.WriteBytes(first)
+		out.Write(block.Bytes())
+		blocks++
+		distinct += uint64(entries)
+	}
+
+	var footer [indexFooterSize]byte
+	binary.LittleEndian.PutUint64(footer[0:], uint64(cw.n))
+	binary.LittleEndian.PutUint64(footer[8:], uint64(index.Len()))
+	binary.LittleEndian.PutUint64(footer[16:], blocks)
+	binary.LittleEndian.PutUint64(footer[24:], distinct)
+	binary.LittleEndian.PutUint64(footer[32:], size)
+	binary.LittleEndian.PutUint32(footer[40:], crc32.Checksum(index.Bytes(), castagnoli))
+	copy(footer[44:], indexMagic)
+	out.Write(index.Bytes())
+	out.Write(footer[:])
+	return cw.n, out.Err
+}
+
+// Index is a read-only counted multiset stored by WriteIndex, answering queries with a single block read.
+// An index is safe for concurrent use if its io.ReaderAt is.
+type Index struct {
+	r           io.ReaderAt
+	keyType     utils.KeyType
+	keyEncoding byte
+	blocks      []indexBlock
+	distinct    int
+	size        int
+}
+
+// indexBlock is the in-memory index entry of a block.
+type indexBlock struct {
+	offset  int64
+	length  int
+	entries int
+	before  int // number of elements in preceding blocks
+	crc     uint32
+	first   interface{}
+}
+
+// OpenIndex opens the index of the given size in bytes stored in r by WriteIndex,
+// reading its header and sparse index. Keys are compared with the comparator registered for the recorded key type.
+// Errors are an *IndexError unless r could not be read.
+func OpenIndex(r io.ReaderAt, size int64) (*Index, error) {
+	if size < int64(len(indexMagic)+2+indexFooterSize) {
+		return nil, &IndexError{Block: -1, Err: ErrIndexFormat}
+	}
+	var footer [indexFooterSize]byte
+	if _, err := r.ReadAt(footer[:], size-indexFooterSize); err != nil {
+		return nil, err
+	}
+	br := &wire.Reader{R: bufio.NewReader(io.NewSectionReader(r, 0, size-indexFooterSize))}
+	magic := br.Read(len(indexMagic))
+	version := br.Read(1)
+	if br.Err != nil || string(magic) != indexMagic || version[0] != indexVersion || string(footer[44:]) != indexMagic {
+		return nil, &IndexError{Block: -1, Err: ErrIndexFormat}
+	}
+	name := string(br.ReadBytes())
+	keyEncoding := br.Read(1)
+	if br.Err != nil {
+		return nil, indexCorrupt(-1, "%v", br.Err)
+	}
+	decoder, err := newEntryDecoder(br, name, keyEncoding[0])
+	if err != nil {
+		return nil, indexCorrupt(-1, "%v", err)
+	}
+
+	indexOffset := binary.LittleEndian.Uint64(footer[0:])
+	indexLength := binary.LittleEndian.Uint64(footer[8:])
+	blocks := binary.LittleEndian.Uint64(footer[16:])
+	index := &Index{
+		r:           r,
+		keyType:     decoder.keyType,
+		keyEncoding: keyEncoding[0],
+		distinct:    int(binary.LittleEndian.Uint64(footer[24:])),
+		size:        int(binary.LittleEndian.Uint64(footer[32:])),
+	}
+	if indexOffset > uint64(size-indexFooterSize) || indexLength != uint64(size-indexFooterSize)-indexOffset ||
+		blocks > indexLength || index.distinct < 0 || index.size < 0 {
+		return nil, indexCorrupt(-1, "invalid footer")
+	}
+	data := make([]byte, indexLength)
+	if _, err := r.ReadAt(data, int64(indexOffset)); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(data, castagnoli) != binary.LittleEndian.Uint32(footer[40:]) {
+		return nil, indexCorrupt(-1, "index checksum mismatch")
+	}
+	br = &wire.Reader{R: bytes.NewReader(data)}
+	index.blocks = make([]indexBlock, blocks)
+	distinct := 0
+	for i := range index.blocks {
+		block := &index.blocks[i]
+		block.offset = int64(br.ReadUvarint())
+		block.length = int(br.ReadUvarint())
+		block.entries = int(br.ReadUvarint())
+		block.before = int(br.ReadUvarint())
+		block.crc = binary.LittleEndian.Uint32(br.Read(4))
+		first := br.ReadBytes()
+		if br.Err != nil {
+			return nil, indexCorrupt(i, "%v", br.Err)
+		}
+		if block.offset < 0 || block.length < 0 || block.offset+int64(block.length) > int64(indexOffset) {
+			return nil, indexCorrupt(i, "out of bounds")
+		}
+		// every entry takes at least a byte for its key and one for its count
+		if block.entries < 0 || block.entries > block.length/2 {
+			return nil, indexCorrupt(i, "%d entries in %d bytes", block.entries, block.length)
+		}
+		if block.first, err = index.keyType.Codec.Decode(first); err != nil {
+			return nil, indexCorrupt(i, "%v", err)
+		}
+		distinct += block.entries
+	}
+	if distinct != index.distinct {
+		return nil, indexCorrupt(-1, "%d keys recorded but %d indexed", index.distinct, distinct)
+	}
+	return index, nil
+}
+
+// Comparator returns the comparator registered for the index's key type.
+func (index *Index) Comparator() utils.Comparator {
+	return index.keyType.Comparator
+}
+
+// Size returns the number of elements in the index, counting repetitions.
+func (index *Index) Size() int {
+	return index.size
+}
+
+// Distinct returns the number of distinct keys in the index.
+func (index *Index) Distinct() int {
+	return index.distinct
+}
+
+// CountSmaller returns the number of elements strictly smaller than key.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (index *Index) CountSmaller(key interface{}) (int, error) {
+	return index.count(key, false)
+}
+
+// CountSmallerOrEqual returns the number of elements smaller than or equal to key.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (index *Index) CountSmallerOrEqual(key interface{}) (int, error) {
+	return index.count(key, true)
+}
+
+// CountRange returns the number of elements with lo <= key <= hi.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (index *Index) CountRange(lo, hi interface{}) (int, error) {
+	if index.Comparator()(lo, hi) > 0 {
+		return 0, nil
+	}
+	smaller, err := index.CountSmaller(lo)
+	if err != nil {
+		return 0, err
+	}
+	smallerOrEqual, err := index.CountSmallerOrEqual(hi)
+	if err != nil {
+		return 0, err
+	}
+	return smallerOrEqual - smaller, nil
+}
+
+// Select returns the key of the element at the given in-order position counting repetitions,
+// found is false if rank is out of range.
+func (index *Index) Select(rank int) (key interface{}, found bool, err error) {
+	if rank < 0 || rank >= index.size {
+		return nil, false, nil
+	}
+	i := sort.Search(len(index.blocks), func(i int) bool { return index.blocks[i].before > rank }) - 1
+	if i < 0 {
+		return nil, false, indexCorrupt(-1, "no blocks for %d elements", index.size)
+	}
+	entries, err := index.readBlock(i)
+	if err != nil {
+		return nil, false, err
+	}
+	position := index.blocks[i].before
+	for _, entry := range entries {
+		if position += entry.Count; rank < position {
+			return entry.Key, true, nil
+		}
+	}
+	return nil, false, indexCorrupt(i, "counts do not match")
+}
+
+// count returns the number of elements smaller than key, or smaller than or equal to key if orEqual is set.
+func (index *Index) count(key interface{}, orEqual bool) (int, error) {
+	i := index.search(key)
+	if i < 0 {
+		return 0, nil
+	}
+	entries, err := index.readBlock(i)
+	if err != nil {
+		return 0, err
+	}
+	count := index.blocks[i].before
+	for _, entry := range entries {
+		if compare := index.Comparator()(entry.Key, key); compare > 0 || compare == 0 && !orEqual {
+			break
+		}
+		count += entry.Count
+	}
+	return count, nil
+}
+
+// search returns the last block whose first key is smaller than or equal to key, -1 if none.
+func (index *Index) search(key interface{}) int {
+	return sort.Search(len(index.blocks), func(i int) bool {
+		return index.Comparator()(index.blocks[i].first, key) > 0
+	}) - 1
+}
+
+// readBlock reads and verifies the entries of block i.
+func (index *Index) readBlock(i int) ([]Entry, error) {
+	block := index.blocks[i]
+	data := make([]byte, block.length)
+	if _, err := index.r.ReadAt(data, block.offset); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(data, castagnoli) != block.crc {
+		return nil, indexCorrupt(i, "checksum mismatch")
+	}
+	r := bytes.NewReader(data)
+	decoder := &entryDecoder{br: &wire.Reader{R: r}, keyType: index.keyType, keyEncoding: index.keyEncoding}
+	entries := make([]Entry, block.entries)
+	for j := range entries {
+		entry, err := decoder.decode()
+		if err != nil {
+			return nil, indexCorrupt(i, "%v", err)
+		}
+		entries[j] = entry
+	}
+	if r.Len() != 0 {
+		return nil, indexCorrupt(i, "trailing bytes")
+	}
+	return entries, nil
+}
+
+// Iterator returns an iterator over the distinct keys of the index in-order, reading one block at a time.
+func (index *Index) Iterator() *IndexIterator {
+	return &IndexIterator{index: index, block: -1}
+}
+
+// IndexIterator iterates over the entries of an Index.
+type IndexIterator struct {
+	index   *Index
+	block   int
+	entries []Entry
+	offset  int
+	err     error
+}
+
+// Next moves the iterator to the next distinct key and returns true if there was one.
+// It returns false at the end of the index or on error, see Err.
+func (iterator *IndexIterator) Next() bool {
+	if iterator.err != nil {
+		return false
+	}
+	iterator.offset++
+	for iterator.offset >= len(iterator.entries) {
+		if iterator.block+1 >= len(iterator.index.blocks) {
+			iterator.offset = len(iterator.entries)
+			return false
+		}
+		if !iterator.load(iterator.block + 1) {
+			return false
+		}
+		iterator.offset = 0
+	}
+	return true
+}
+
+// Seek moves the iterator to the smallest key larger than or equal to key and returns true if there is one.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (iterator *IndexIterator) Seek(key interface{}) bool {
+	i := iterator.index.search(key)
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(iterator.index.blocks) || !iterator.load(i) {
+		return false
+	}
+	iterator.offset = sort.Search(len(iterator.entries), func(j int) bool {
+		return iterator.index.Comparator()(iterator.entries[j].Key, key) >= 0
+	}) - 1
+	return iterator.Next()
+}
+
+func (iterator *IndexIterator) load(i int) bool {
+	iterator.entries, iterator.err = iterator.index.readBlock(i)
+	iterator.block = i
+	iterator.offset = -1
+	return iterator.err == nil
+}
+
+// Key returns the current key.
+func (iterator *IndexIterator) Key() interface{} {
+	return iterator.entries[iterator.offset].Key
+}
+
+// Count returns the multiplicity of the current key.
+func (iterator *IndexIterator) Count() int {
+	return iterator.entries[iterator.offset].Count
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (iterator *IndexIterator) Err() error {
+	return iterator.err
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree/internal/wire"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func TestRedBlackTreeIndex(t *testing.T) {
+	tree := NewWithIntComparator()
+	for i := 0; i < 1000; i++ {
+		tree.PutN(i*3, i%4+1)
+	}
+	var buf bytes.Buffer
+	n, err := tree.WriteIndex(&buf, IndexOptions{BlockSize: 7})
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("Got %v %v expected %v", n, err, buf.Len())
+	}
+	index, err := OpenIndex(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := index.Size(), tree.Size(); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if actualValue, expectedValue := index.Distinct(), 1000; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	for key := -2; key < 3002; key++ {
+		if actualValue, _ := index.CountSmaller(key); actualValue != tree.CountSmaller(key) {
+			t.Fatalf("CountSmaller(%v): Got %v expected %v", key, actualValue, tree.CountSmaller(key))
+		}
+		expectedValue := tree.CountSmallerOrEqual(key+10) - tree.CountSmaller(key)
+		if actualValue, _ := index.CountRange(key, key+10); actualValue != expectedValue {
+			t.Fatalf("CountRange(%v): Got %v expected %v", key, actualValue, expectedValue)
+		}
+	}
+	keys := tree.Keys()
+	for rank := -1; rank <= tree.Size(); rank++ {
+		key, found, err := index.Select(rank)
+		if err != nil || found != (rank >= 0 && rank < tree.Size()) || found && key != keys[rank] {
+			t.Fatalf("Select(%v): Got %v %v %v", rank, key, found, err)
+		}
+	}
+
+	iterator := index.Iterator()
+	count := 0
+	for node := tree.Left(); node != nil; node = node.successor() {
+		if !iterator.Next() || iterator.Key() != node.Key || iterator.Count() != node.NumRepeated+1 {
+			t.Fatalf("Got %v expected %v", iterator.Key(), node.Key)
+		}
+		count++
+	}
+	if iterator.Next() || iterator.Err() != nil || count != 1000 {
+		t.Errorf("Got %v expected end of index", iterator.Err())
+	}
+	if !iterator.Seek(1000) || iterator.Key() != 1002 {
+		t.Errorf("Got %v expected %v", iterator.Key(), 1002)
+	}
+	if !iterator.Seek(-5) || iterator.Key() != 0 {
+		t.Errorf("Got %v expected %v", iterator.Key(), 0)
+	}
+	if !iterator.Seek(20) || iterator.Key() != 21 || !iterator.Next() || iterator.Key() != 24 {
+		t.Errorf("Got %v expected %v", iterator.Key(), 24)
+	}
+	if iterator.Seek(3000) {
+		t.Errorf("Got %v expected end of index", iterator.Key())
+	}
+}
+
+func longNameIntComparator(a, b interface{}) int {
+	return utils.IntComparator(a, b)
+}
+
+func init() {
+	utils.RegisterKeyType(utils.KeyType{
+		Name:       "redblacktree_test." + strings.Repeat("long", 100),
+		Type:       reflect.TypeOf(0),
+		Codec:      utils.IntCodec,
+		Comparator: longNameIntComparator,
+	})
+}
+
+func TestRedBlackTreeIndexLongKeyTypeName(t *testing.T) {
+	tree := NewWith(longNameIntComparator)
+	for i := 0; i < 10; i++ {
+		tree.Put(i)
+	}
+	var buf bytes.Buffer
+	if _, err := tree.WriteIndex(&buf, IndexOptions{}); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	index, err := OpenIndex(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if count, err := index.CountSmaller(5); count != 5 || err != nil {
+		t.Errorf("Got %v %v expected 5", count, err)
+	}
+}
+
+func TestRedBlackTreeIndexEmptyAndInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewWithStringComparator().WriteIndex(&buf, IndexOptions{}); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	index, err := OpenIndex(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if count, err := index.CountSmaller("a"); count != 0 || err != nil {
+		t.Errorf("Got %v %v expected 0", count, err)
+	}
+	if _, found, _ := index.Select(0); found || index.Iterator().Next() {
+		t.Errorf("Got element in empty index")
+	}
+
+	tree := NewWithStringComparator()
+	for i := 0; i < 100; i++ {
+		tree.Put(fmt.Sprintf("key%03d", i))
+	}
+	buf.Reset()
+	tree.WriteIndex(&buf, IndexOptions{BlockSize: 10})
+	data := buf.Bytes()
+	if _, err := OpenIndex(bytes.NewReader(data[:len(data)-1]), int64(len(data)-1)); !errors.Is(err, ErrIndexFormat) {
+		t.Errorf("Got %v expected %v", err, ErrIndexFormat)
+	}
+	data[len(data)-indexFooterSize-1] ^= 0xff
+	if _, err := OpenIndex(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrIndexCorrupt) {
+		t.Errorf("Got %v expected %v", err, ErrIndexCorrupt)
+	}
+	data[len(data)-indexFooterSize-1] ^= 0xff
+	data[len(indexMagic)+20] ^= 0xff
+	index, err = OpenIndex(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	_, err = index.CountSmaller("key005")
+	var indexErr *IndexError
+	if !errors.Is(err, ErrIndexCorrupt) || !errors.As(err, &indexErr) || indexErr.Block != 0 {
+		t.Errorf("Got %v expected %v in block 0", err, ErrIndexCorrupt)
+	}
+	if actualValue, expectedValue := err.Error(), "redblacktree: block 0: index corrupt: checksum mismatch"; actualValue != expectedValue {
+		t.Errorf("Got %q expected %q", actualValue, expectedValue)
+	}
+	if count, err := index.CountSmaller("key050"); count != 50 || err != nil {
+		t.Errorf("Got %v %v expected 50", count, err)
+	}
+}
+
+func TestRedBlackTreeIndexCraftedEntries(t *testing.T) {
+	tree := NewWithIntComparator()
+	tree.Put(1)
+	tree.Put(2)
+	var buf bytes.Buffer
+	tree.WriteIndex(&buf, IndexOptions{BlockSize: 1})
+	data := buf.Bytes()
+	footer := append([]byte(nil), data[len(data)-indexFooterSize:]...)
+	offset := binary.LittleEndian.Uint64(footer[0:])
+
+	// rewrite the entries of the two blocks to 1<<20+1 and 1-1<<20, keeping their sum and all checksums valid
+	var sparse bytes.Buffer
+	r := &wire.Reader{R: bytes.NewReader(data[offset : len(data)-indexFooterSize])}
+	w := &wire.Writer{W: &sparse}
+	for _, entries := range []uint64{1<<20 + 1, ^uint64(1<<20 - 2)} {
+		blockOffset, length := r.ReadUvarint(), r.ReadUvarint()
+		r.ReadUvarint()
+		before, crc, first := r.ReadUvarint(), r.Read(4), r.ReadBytes()
+		w.WriteUvarint(blockOffset)
+		w.WriteUvarint(length)
+		w.WriteUvarint(entries)
+		w.WriteUvarint(before)
+		w.Write(crc)
+		w.WriteBytes(first)
+	}
+	binary.LittleEndian.PutUint64(footer[8:], uint64(sparse.Len()))
+	binary.LittleEndian.PutUint32(footer[40:], crc32.Checksum(sparse.Bytes(), castagnoli))
+	crafted := append(append(append([]byte(nil), data[:offset]...), sparse.Bytes()...), footer...)
+
+	_, err := OpenIndex(bytes.NewReader(crafted), int64(len(crafted)))
+	var indexErr *IndexError
+	if !errors.Is(err, ErrIndexCorrupt) || !errors.As(err, &indexErr) || indexErr.Block != 0 {
+		t.Errorf("Got %v expected %v in block 0", err, ErrIndexCorrupt)
+	}
+}
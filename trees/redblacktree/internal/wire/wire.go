@@ -0,0 +1,128 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package wire reads and writes the fields shared by the binary formats of the trees:
+// raw bytes, uvarints, little-endian uint64s and uvarint length prefixed byte slices.
+//
+// Reader and Writer remember the first error so callers can check it once after a sequence of fields.
+package wire
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	maxInt = int(^uint(0) >> 1)
+
+	// maxChunk bounds the allocation for a length prefixed byte slice ahead of its data.
+	maxChunk = 64 << 10
+)
+
+// Writer writes fields to W.
+type Writer struct {
+	W   io.Writer
+	Err error // first write error
+	buf [binary.MaxVarintLen64]byte
+}
+
+// Write writes data.
+func (w *Writer) Write(data []byte) {
+	if w.Err == nil {
+		_, w.Err = w.W.Write(data)
+	}
+}
+
+// WriteUvarint writes value as a uvarint.
+func (w *Writer) WriteUvarint(value uint64) {
+	w.Write(w.buf[:binary.PutUvarint(w.buf[:], value)])
+}
+
+// WriteUint64 writes value as 8 little-endian bytes.
+func (w *Writer) WriteUint64(value uint64) {
+	binary.LittleEndian.PutUint64(w.buf[:], value)
+	w.Write(w.buf[:8])
+}
+
+// WriteBytes writes data prefixed by its uvarint length.
+func (w *Writer) WriteBytes(data []byte) {
+	w.WriteUvarint(uint64(len(data)))
+	w.Write(data)
+}
+
+// Reader reads fields from R. A premature end of input is reported as io.ErrUnexpectedEOF.
+type Reader struct {
+	R   io.ByteReader
+	Err error // first read error
+}
+
+// Read reads n bytes, returning zeros after an error.
+func (r *Reader) Read(n int) []byte {
+	data := make([]byte, n)
+	if r.Err != nil {
+		return data
+	}
+	if reader, ok := r.R.(io.Reader); ok {
+		_, r.Err = io.ReadFull(reader, data)
+	} else {
+		for i := 0; i < n && r.Err == nil; i++ {
+			data[i], r.Err = r.R.ReadByte()
+		}
+	}
+	if r.Err == io.EOF {
+		r.Err = io.ErrUnexpectedEOF
+	}
+	return data
+}
+
+// ReadUvarint reads a uvarint.
+func (r *Reader) ReadUvarint() uint64 {
+	if r.Err != nil {
+		return 0
+	}
+	var value uint64
+	value, r.Err = binary.ReadUvarint(r.R)
+	if r.Err == io.EOF {
+		r.Err = io.ErrUnexpectedEOF
+	}
+	return value
+}
+
+// ReadUint64 reads 8 little-endian bytes.
+func (r *Reader) ReadUint64() uint64 {
+	return binary.LittleEndian.Uint64(r.Read(8))
+}
+
+// ReadBytes reads a byte slice prefixed by its uvarint length. Lengths exceeding Remaining are rejected,
+// and longer slices are read in chunks so a corrupt length cannot allocate much more than is sent.
+func (r *Reader) ReadBytes() []byte {
+	n := r.ReadUvarint()
+	if r.Err == nil && n > uint64(r.Remaining()) {
+		r.Err = io.ErrUnexpectedEOF
+	}
+	if r.Err != nil {
+		return nil
+	}
+	if n <= maxChunk {
+		return r.Read(int(n))
+	}
+	var data []byte
+	for uint64(len(data)) < n && r.Err == nil {
+		chunk := n - uint64(len(data))
+		if chunk > maxChunk {
+			chunk = maxChunk
+		}
+		data = append(data, r.Read(int(chunk))...)
+	}
+	return data
+}
+
+// Remaining returns an upper bound of the number of bytes left to read: the length of readers with a Len
+// method, such as bytes.Reader, and the largest int otherwise.
+func (r *Reader) Remaining() int {
+	if reader, ok := r.R.(interface{ Len() int }); ok {
+		return reader.Len()
+	}
+	return maxInt
+}
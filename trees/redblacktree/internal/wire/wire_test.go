@@ -0,0 +1,98 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// byteReader has no Read method, so Reader reads it byte by byte.
+type byteReader struct {
+	r *bytes.Reader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	return br.r.ReadByte()
+}
+
+func TestWireRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Writer{W: &buf}
+	w.Write([]byte("ab"))
+	w.WriteUvarint(300)
+	w.WriteUint64(1 << 60)
+	w.WriteBytes([]byte("hello"))
+	w.WriteBytes(bytes.Repeat([]byte{7}, 3*maxChunk+1))
+	if w.Err != nil {
+		t.Fatal(w.Err)
+	}
+
+	readers := map[string]io.ByteReader{
+		"bytes": bytes.NewReader(buf.Bytes()),
+		"bufio": bufio.NewReader(bytes.NewReader(buf.Bytes())),
+		"byte":  byteReader{bytes.NewReader(buf.Bytes())},
+	}
+	for name, br := range readers {
+		r := &Reader{R: br}
+		if actualValue := string(r.Read(2)); actualValue != "ab" {
+			t.Errorf("%s: Got %q expected %q", name, actualValue, "ab")
+		}
+		if actualValue := r.ReadUvarint(); actualValue != 300 {
+			t.Errorf("%s: Got %v expected %v", name, actualValue, 300)
+		}
+		if actualValue := r.ReadUint64(); actualValue != 1<<60 {
+			t.Errorf("%s: Got %v expected %v", name, actualValue, uint64(1<<60))
+		}
+		if actualValue := string(r.ReadBytes()); actualValue != "hello" {
+			t.Errorf("%s: Got %q expected %q", name, actualValue, "hello")
+		}
+		if actualValue := r.ReadBytes(); !bytes.Equal(actualValue, bytes.Repeat([]byte{7}, 3*maxChunk+1)) {
+			t.Errorf("%s: Got %d bytes expected %d", name, len(actualValue), 3*maxChunk+1)
+		}
+		if r.Err != nil {
+			t.Errorf("%s: Got error %v", name, r.Err)
+		}
+		r.Read(1)
+		if r.Err != io.ErrUnexpectedEOF {
+			t.Errorf("%s: Got %v expected %v", name, r.Err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestWireErrors(t *testing.T) {
+	// a length larger than the input is rejected before allocating for it
+	r := &Reader{R: bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x0f, 1})}
+	if data := r.ReadBytes(); data != nil || r.Err != io.ErrUnexpectedEOF {
+		t.Errorf("Got %v %v expected %v", data, r.Err, io.ErrUnexpectedEOF)
+	}
+	r = &Reader{R: bufio.NewReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x0f, 1}))}
+	if r.ReadBytes(); r.Err != io.ErrUnexpectedEOF {
+		t.Errorf("Got %v expected %v", r.Err, io.ErrUnexpectedEOF)
+	}
+
+	failure := errors.New("failure")
+	w := &Writer{W: failingWriter{failure}}
+	w.WriteBytes([]byte("a"))
+	w.WriteUvarint(1)
+	if w.Err != failure {
+		t.Errorf("Got %v expected %v", w.Err, failure)
+	}
+	if r := (&Reader{R: strings.NewReader("")}); r.ReadUvarint() != 0 || r.Err != io.ErrUnexpectedEOF {
+		t.Errorf("Got %v expected %v", r.Err, io.ErrUnexpectedEOF)
+	}
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write(data []byte) (int, error) {
+	return 0, w.err
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package redblacktree
+
+import "iter"
+
+// All returns an iterator over distinct keys in-order, yielding each key with its count.
+//
+//	for key, count := range tree.All() { ... }
+func (tree *Tree) All() iter.Seq2[interface{}, int] {
+	return func(yield func(interface{}, int) bool) {
+		for node := tree.Left(); node != nil; node = node.successor() {
+			if !yield(node.Key, node.NumRepeated+1) {
+				return
+			}
+		}
+	}
+}
+
+// Occurrences returns an iterator over every element in-order, yielding a key once per occurrence.
+func (tree *Tree) Occurrences() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		for node := tree.Left(); node != nil; node = node.successor() {
+			for i := 0; i <= node.NumRepeated; i++ {
+				if !yield(node.Key) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Backward returns an iterator over distinct keys in reverse order, yielding each key with its count.
+func (tree *Tree) Backward() iter.Seq2[interface{}, int] {
+	return func(yield func(interface{}, int) bool) {
+		for node := tree.Right(); node != nil; node = node.predecessor() {
+			if !yield(node.Key, node.NumRepeated+1) {
+				return
+			}
+		}
+	}
+}
+
+// Range returns an iterator over distinct keys k with lo <= k <= hi in-order, yielding each key with its count.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (tree *Tree) Range(lo, hi interface{}) iter.Seq2[interface{}, int] {
+	return func(yield func(interface{}, int) bool) {
+		node, _ := tree.Ceiling(lo)
+		for ; node != nil && tree.compare(node.Key, hi) <= 0; node = node.successor() {
+			if !yield(node.Key, node.NumRepeated+1) {
+				return
+			}
+		}
+	}
+}
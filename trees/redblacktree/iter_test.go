@@ -0,0 +1,112 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package redblacktree
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRedBlackTreeAll(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{5, 6, 7, 3, 4, 1, 2, 1, 1, 2} {
+		tree.Put(key)
+	}
+	var keys, counts []interface{}
+	for key, count := range tree.All() {
+		keys = append(keys, key)
+		counts = append(counts, count)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v %v", keys, counts), "[1 2 3 4 5 6 7] [3 2 1 1 1 1 1]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	for range NewWithIntComparator().All() {
+		t.Errorf("Shouldn't iterate on empty tree")
+	}
+}
+
+func TestRedBlackTreeOccurrences(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{5, 6, 7, 3, 4, 1, 2, 1, 1, 2} {
+		tree.Put(key)
+	}
+	var keys []interface{}
+	for key := range tree.Occurrences() {
+		keys = append(keys, key)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", keys), fmt.Sprintf("%v", tree.Keys()); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeBackward(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{5, 6, 7, 3, 4, 1, 2, 1, 1, 2} {
+		tree.Put(key)
+	}
+	var keys []interface{}
+	for key, count := range tree.Backward() {
+		keys = append(keys, fmt.Sprintf("%v:%v", key, count))
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", keys), "[7:1 6:1 5:1 4:1 3:1 2:2 1:3]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeRange(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{5, 6, 7, 3, 4, 1, 2, 1, 1, 2} {
+		tree.Put(key)
+	}
+	tests := [][]interface{}{
+		{2, 5, "[2 3 4 5]"},
+		{0, 1, "[1]"},
+		{7, 10, "[7]"},
+		{8, 10, "[]"},
+		{4, 3, "[]"},
+		{-5, 20, "[1 2 3 4 5 6 7]"},
+	}
+	for _, test := range tests {
+		keys := []interface{}{}
+		for key := range tree.Range(test[0], test[1]) {
+			keys = append(keys, key)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", keys), test[2]; actualValue != expectedValue {
+			t.Errorf("Range(%v, %v): Got %v expected %v", test[0], test[1], actualValue, expectedValue)
+		}
+	}
+}
+
+func TestRedBlackTreeIterEarlyBreak(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{5, 6, 7, 3, 4, 1, 2, 1, 1, 2} {
+		tree.Put(key)
+	}
+	seq := tree.Occurrences()
+	for i := 0; i < 2; i++ {
+		var keys []interface{}
+		for key := range seq {
+			if len(keys) == 4 {
+				break
+			}
+			keys = append(keys, key)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", keys), "[1 1 1 2]"; actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+	for key := range tree.All() {
+		if key == 3 {
+			break
+		}
+	}
+	if actualValue, expectedValue := tree.Size(), 10; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
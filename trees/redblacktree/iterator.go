@@ -8,6 +8,7 @@ import "github.com/afiodorov/countedredblacktree/containers"
 
 func assertIteratorImplementation() {
 	var _ containers.ReverseIteratorWithKey = (*Iterator)(nil)
+	var _ containers.ReverseIteratorWithIndex = (*Iterator)(nil)
 }
 
 // Iterator holding the iterator's state
@@ -15,6 +16,9 @@ type Iterator struct {
 	tree     *Tree
 	node     *Node
 	position position
+	lo, hi   interface{} // inclusive bounds, nil if unbounded
+	rank     int         // in-order position of the current element counting repetitions
+	offset   int         // position of the current element within the node's repetitions
 }
 
 type position byte
@@ -28,16 +32,34 @@ func (tree *Tree) Iterator() Iterator {
 	return Iterator{tree: tree, node: nil, position: begin}
 }
 
+// IteratorAt returns a stateful iterator positioned at the ceiling node of the key,
+// i.e. the smallest element that is larger than or equal to the key.
+// If there is no ceiling the iterator is positioned one-past-the-end.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (tree *Tree) IteratorAt(key interface{}) Iterator {
+	iterator := tree.Iterator()
+	iterator.Seek(key)
+	return iterator
+}
+
+// RangeIterator returns a stateful iterator constrained to elements with lo <= key <= hi.
+// A nil bound leaves that side unbounded.
+// Begin() and End() position the iterator just outside the bounds.
+func (tree *Tree) RangeIterator(lo, hi interface{}) Iterator {
+	return Iterator{tree: tree, node: nil, position: begin, lo: lo, hi: hi}
+}
+
 // Next moves the iterator to the next element and returns true if there was a next element in the container.
 // If Next() returns true, then next element's key and value can be retrieved by Key() and Value().
 // If Next() was called for the first time, then it will point the iterator to the first element if it exists.
 // Modifies the state of the iterator.
 func (iterator *Iterator) Next() bool {
+	prev, position := iterator.node, iterator.position
 	if iterator.position == end {
 		goto end
 	}
 	if iterator.position == begin {
-		left := iterator.tree.Left()
+		left := iterator.first()
 		if left == nil {
 			goto end
 		}
@@ -55,7 +77,7 @@ func (iterator *Iterator) Next() bool {
 		node := iterator.node
 		for iterator.node.Parent != nil {
 			iterator.node = iterator.node.Parent
-			if iterator.tree.Comparator(node.Key, iterator.node.Key) <= 0 {
+			if iterator.tree.compare(node.Key, iterator.node.Key) <= 0 {
 				goto between
 			}
 		}
@@ -67,6 +89,15 @@ end:
 	return false
 
 between:
+	if !iterator.belowHi(iterator.node) {
+		goto end
+	}
+	if position == between {
+		iterator.rank += prev.NumRepeated + 1 - iterator.offset
+	} else {
+		iterator.rank = iterator.node.rank()
+	}
+	iterator.offset = 0
 	iterator.position = between
 	return true
 }
@@ -75,11 +106,12 @@ between:
 // If Prev() returns true, then previous element's key and value can be retrieved by Key() and Value().
 // Modifies the state of the iterator.
 func (iterator *Iterator) Prev() bool {
+	position := iterator.position
 	if iterator.position == begin {
 		goto begin
 	}
 	if iterator.position == end {
-		right := iterator.tree.Right()
+		right := iterator.last()
 		if right == nil {
 			goto begin
 		}
@@ -97,7 +129,7 @@ func (iterator *Iterator) Prev() bool {
 		node := iterator.node
 		for iterator.node.Parent != nil {
 			iterator.node = iterator.node.Parent
-			if iterator.tree.Comparator(node.Key, iterator.node.Key) >= 0 {
+			if iterator.tree.compare(node.Key, iterator.node.Key) >= 0 {
 				goto between
 			}
 		}
@@ -109,6 +141,15 @@ begin:
 	return false
 
 between:
+	if !iterator.aboveLo(iterator.node) {
+		goto begin
+	}
+	if position == between {
+		iterator.rank -= iterator.offset + iterator.node.NumRepeated + 1
+	} else {
+		iterator.rank = iterator.node.rank()
+	}
+	iterator.offset = 0
 	iterator.position = between
 	return true
 }
@@ -119,9 +160,43 @@ func (iterator *Iterator) Key() interface{} {
 	return iterator.node.Key
 }
 
-// NumGreater returns number of nodes that are bigger than current node
+// Index returns the in-order position of the current element counting repetitions.
+// After Next() or Prev() it is the position of the first repetition of the current key.
+// One-before-first it is the position preceding the first element within bounds
+// and one-past-the-end it is the position following the last element within bounds.
+// Does not modify the state of the iterator.
+func (iterator *Iterator) Index() int {
+	switch iterator.position {
+	case begin:
+		if iterator.lo == nil {
+			return -1
+		}
+		return iterator.tree.CountSmaller(iterator.lo) - 1
+	case end:
+		if iterator.hi == nil {
+			return iterator.tree.Size()
+		}
+		return iterator.tree.CountSmallerOrEqual(iterator.hi)
+	}
+	return iterator.rank
+}
+
+// Rank returns the in-order position of the current element counting repetitions, same as Index().
+func (iterator *Iterator) Rank() int {
+	return iterator.Index()
+}
+
+// NumSmaller returns number of elements that are smaller than current node
+func (iterator *Iterator) NumSmaller() int {
+	return iterator.rank - iterator.offset
+}
+
+// NumGreater returns number of elements that are bigger than current node
 func (iterator *Iterator) NumGreater() int {
-	return iterator.tree.NumGreater(iterator.node)
+	if iterator.node == nil {
+		return 0
+	}
+	return iterator.tree.Size() - iterator.NumSmaller() - iterator.Count()
 }
 
 func (iterator *Iterator) Count() int {
@@ -157,3 +232,95 @@ func (iterator *Iterator) Last() bool {
 	iterator.End()
 	return iterator.Prev()
 }
+
+// Seek moves the iterator to the ceiling node of the key, i.e. the smallest element within
+// the iterator's bounds that is larger than or equal to the key, and returns true if it exists.
+// Otherwise the iterator is moved one-past-the-end and false is returned.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (iterator *Iterator) Seek(key interface{}) bool {
+	node, _ := iterator.tree.Ceiling(key)
+	if node != nil && !iterator.aboveLo(node) {
+		node = iterator.first()
+	}
+	if node == nil || !iterator.belowHi(node) {
+		iterator.End()
+		return false
+	}
+	iterator.node = node
+	iterator.position = between
+	iterator.rank = node.rank()
+	iterator.offset = 0
+	return true
+}
+
+// SeekFloor moves the iterator to the floor node of the key, i.e. the largest element within
+// the iterator's bounds that is smaller than or equal to the key, and returns true if it exists.
+// Otherwise the iterator is moved one-before-first and false is returned.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (iterator *Iterator) SeekFloor(key interface{}) bool {
+	node, _ := iterator.tree.Floor(key)
+	if node != nil && !iterator.belowHi(node) {
+		node = iterator.last()
+	}
+	if node == nil || !iterator.aboveLo(node) {
+		iterator.Begin()
+		return false
+	}
+	iterator.node = node
+	iterator.position = between
+	iterator.rank = node.rank()
+	iterator.offset = 0
+	return true
+}
+
+// first returns the smallest node within the iterator's bounds ignoring the upper bound.
+func (iterator *Iterator) first() *Node {
+	if iterator.lo == nil {
+		return iterator.tree.Left()
+	}
+	node, _ := iterator.tree.Ceiling(iterator.lo)
+	return node
+}
+
+// last returns the largest node within the iterator's bounds ignoring the lower bound.
+func (iterator *Iterator) last() *Node {
+	if iterator.hi == nil {
+		return iterator.tree.Right()
+	}
+	node, _ := iterator.tree.Floor(iterator.hi)
+	return node
+}
+
+func (iterator *Iterator) aboveLo(node *Node) bool {
+	return iterator.lo == nil || iterator.tree.compare(node.Key, iterator.lo) >= 0
+}
+
+func (iterator *Iterator) belowHi(node *Node) bool {
+	return iterator.hi == nil || iterator.tree.compare(node.Key, iterator.hi) <= 0
+}
+
+// SeekRank moves the iterator to the element at the given in-order position counting repetitions
+// and returns true if such element exists within the iterator's bounds.
+// Otherwise the iterator is moved one-before-first or one-past-the-end and false is returned.
+func (iterator *Iterator) SeekRank(rank int) bool {
+	node, first := iterator.tree.selectNode(rank)
+	if rank < 0 || node != nil && !iterator.aboveLo(node) {
+		iterator.Begin()
+		return false
+	}
+	if node == nil || !iterator.belowHi(node) {
+		iterator.End()
+		return false
+	}
+	iterator.node = node
+	iterator.position = between
+	iterator.rank = rank
+	iterator.offset = rank - first
+	return true
+}
+
+// Skip moves the iterator forward by n elements, or backward if n is negative, counting repetitions.
+// Returns true if the iterator landed on an element within its bounds, see SeekRank().
+func (iterator *Iterator) Skip(n int) bool {
+	return iterator.SeekRank(iterator.Index() + n)
+}
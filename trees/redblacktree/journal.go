@@ -0,0 +1,513 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree/internal/wire"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// The journal file format is
+//
+//	magic    "CRBTJRNL"
+//	version  byte
+//	keyType  uvarint length followed by the name of the key type, see utils.RegisterKeyType
+//	base     trailer of the snapshot the journal applies to, zero without snapshot
+//	records  length, checksums and payload per operation, appended as they happen
+//
+// A record is the uint32 little-endian length of its payload, the uint32 little-endian CRC-32C
+// of the length, the uint32 little-endian CRC-32C of the length and the payload, and the payload:
+// the operation byte followed by uvarint n and the key for journalPut, the key for journalRemove
+// and nothing for journalClear. Keys are encoded with the key type's codec.
+//
+// The header is written to a temporary file renamed into place, so only the final record can be torn.
+// Checking the length on its own tells a record extending past the end of the log, which must be
+// the torn final record, from a corrupt length.
+// Recording the base snapshot detects a journal already compacted into the snapshot when
+// a crash happened between writing the snapshot and replacing the journal.
+const (
+	journalMagic      = "CRBTJRNL"
+	journalVersion    = 2
+	journalRecordSize = 4 + 4 + 4
+
+	journalPut    byte = 1
+	journalRemove byte = 2
+	journalClear  byte = 3
+)
+
+// SyncPolicy determines when the journal is synced to disk.
+type SyncPolicy int
+
+const (
+	// SyncEveryOp syncs after every operation: no acknowledged operation is lost in a crash.
+	SyncEveryOp SyncPolicy = iota
+	// SyncInterval syncs in the background every JournalOptions.Interval if operations were appended.
+	SyncInterval
+	// SyncNever leaves syncing to the operating system, operations are only synced by Sync, Compact and Close.
+	SyncNever
+)
+
+// JournalOptions configures a journal.
+type JournalOptions struct {
+	Sync SyncPolicy
+	// Interval between syncs with SyncInterval, one second if zero.
+	Interval time.Duration
+}
+
+// Errors reported by a journal wrapped in a *JournalError.
+var (
+	ErrJournalFormat  = errors.New("not a journal or unsupported version")
+	ErrJournalCorrupt = errors.New("journal corrupt")
+	ErrJournalKeyType = errors.New("journal key type does not match comparator")
+	ErrJournalClosed  = errors.New("journal closed")
+)
+
+// JournalError records the journal file an error occurred with.
+// Use errors.Is to check for ErrJournalFormat, ErrJournalCorrupt, ErrJournalKeyType or ErrJournalClosed.
+type JournalError struct {
+	Path string
+	Err  error
+}
+
+func (e *JournalError) Error() string {
+	return "redblacktree: " + e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *JournalError) Unwrap() error {
+	return e.Err
+}
+
+// Journal makes a tree durable by appending every Put, PutN, Remove and Clear to a write-ahead log
+// before applying it to the tree. Compact writes a snapshot and starts an empty log.
+//
+// The methods of a journal are safe for concurrent use. The tree must only be mutated through the journal
+// and must not be read concurrently with mutations.
+type Journal struct {
+	mu           sync.Mutex
+	tree         *Tree
+	snapshotPath string
+	logPath      string
+	options      JournalOptions
+	keyType      utils.KeyType
+	file         *os.File
+	buf          []byte
+	dirty        bool
+	err          error
+	done         chan struct{}
+	stopped      chan struct{}
+	stopOnce     sync.Once
+}
+
+// OpenJournal recovers the tree from the snapshot at snapshotPath, if it exists, and the operations
+// logged at logPath since, then opens the log for appending. A torn final record left by a crash
+// is discarded. The tree's content is replaced by the recovered state.
+//
+// If the tree has no comparator the one registered for the recorded key type is used,
+// otherwise the comparator must be registered with utils.RegisterKeyType.
+func OpenJournal(tree *Tree, snapshotPath, logPath string, options JournalOptions) (*Journal, error) {
+	if options.Interval <= 0 {
+		options.Interval = time.Second
+	}
+	journal := &Journal{tree: tree, snapshotPath: snapshotPath, logPath: logPath, options: options}
+	base, err := tree.loadSnapshot(snapshotPath)
+	if os.IsNotExist(err) {
+		tree.Clear()
+	} else if err != nil {
+		return nil, err
+	}
+	if err := journal.recover(base); err != nil {
+		return nil, err
+	}
+	if options.Sync == SyncInterval {
+		journal.done = make(chan struct{})
+		journal.stopped = make(chan struct{})
+		go journal.syncEvery(options.Interval)
+	}
+	return journal, nil
+}
+
+// Tree returns the journaled tree.
+func (journal *Journal) Tree() *Tree {
+	return journal.tree
+}
+
+// Put logs and inserts key into the tree.
+func (journal *Journal) Put(key interface{}) error {
+	return journal.PutN(key, 1)
+}
+
+// PutN logs and inserts n occurrences of key into the tree, it does nothing if n is not positive.
+func (journal *Journal) PutN(key interface{}, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if err := journal.append(journalPut, key, n); err != nil {
+		return err
+	}
+	journal.tree.PutN(key, n)
+	return nil
+}
+
+// Remove logs and removes one occurrence of key from the tree, reporting whether key was found.
+// Removing a missing key is not logged.
+func (journal *Journal) Remove(key interface{}) (bool, error) {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if !journal.tree.Get(key) {
+		return false, journal.err
+	}
+	if err := journal.append(journalRemove, key, 0); err != nil {
+		return false, err
+	}
+	return journal.tree.Remove(key), nil
+}
+
+// Clear logs and removes all keys from the tree.
+func (journal *Journal) Clear() error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if err := journal.append(journalClear, nil, 0); err != nil {
+		return err
+	}
+	journal.tree.Clear()
+	return nil
+}
+
+// Sync syncs the logged operations to disk.
+func (journal *Journal) Sync() error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	return journal.sync()
+}
+
+// Compact writes a snapshot of the tree and replaces the log by an empty one.
+// A crash during compaction recovers the same tree. If the snapshot was written but the log could not be
+// replaced, the old log no longer matches the snapshot and the error is sticky: the journal accepts no
+// more writes and must be reopened.
+func (journal *Journal) Compact() error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if journal.err != nil {
+		return journal.err
+	}
+	base, err := journal.tree.saveSnapshot(journal.snapshotPath)
+	if err != nil {
+		return err
+	}
+	file, err := journal.create(base)
+	if err != nil {
+		journal.err = err
+		return err
+	}
+	journal.file.Close()
+	journal.file = file
+	journal.dirty = false
+	return nil
+}
+
+// Close syncs and closes the log. Operations on a closed journal return ErrJournalClosed.
+func (journal *Journal) Close() error {
+	// stop syncing before locking, the background sync takes the lock
+	journal.stopOnce.Do(func() {
+		if journal.done != nil {
+			close(journal.done)
+			<-journal.stopped
+		}
+	})
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if errors.Is(journal.err, ErrJournalClosed) {
+		return journal.err
+	}
+	err := journal.sync()
+	if closeErr := journal.file.Close(); err == nil {
+		err = closeErr
+	}
+	journal.err = journal.error(ErrJournalClosed)
+	return err
+}
+
+// append writes a record and syncs it according to the sync policy.
+// Any write or sync error is sticky, as the log may then hold a record that was not applied.
+func (journal *Journal) append(op byte, key interface{}, n int) error {
+	if journal.err != nil {
+		return journal.err
+	}
+	record := append(journal.buf[:0], make([]byte, journalRecordSize)...)
+	record = append(record, op)
+	if op == journalPut {
+		record = appendUvarint(record, uint64(n))
+	}
+	if op != journalClear {
+		encoded, err := journal.keyType.Codec.Encode(key)
+		if err != nil {
+			return err
+		}
+		record = append(record, encoded...)
+	}
+	payload := record[journalRecordSize:]
+	binary.LittleEndian.PutUint32(record[0:], uint32(len(payload)))
+	lengthCRC := crc32.Checksum(record[0:4], castagnoli)
+	binary.LittleEndian.PutUint32(record[4:], lengthCRC)
+	binary.LittleEndian.PutUint32(record[8:], crc32.Update(lengthCRC, castagnoli, payload))
+	journal.buf = record
+	if _, err := journal.file.Write(record); err != nil {
+		journal.err = err
+		return err
+	}
+	journal.dirty = true
+	if journal.options.Sync == SyncEveryOp {
+		return journal.sync()
+	}
+	return nil
+}
+
+func (journal *Journal) sync() error {
+	if journal.err != nil {
+		return journal.err
+	}
+	if !journal.dirty {
+		return nil
+	}
+	if err := journal.file.Sync(); err != nil {
+		journal.err = err
+		return err
+	}
+	journal.dirty = false
+	return nil
+}
+
+// syncEvery syncs the log every interval until the journal is closed.
+func (journal *Journal) syncEvery(interval time.Duration) {
+	defer close(journal.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			journal.mu.Lock()
+			journal.sync()
+			journal.mu.Unlock()
+		case <-journal.done:
+			return
+		}
+	}
+}
+
+// recover replays the log on top of the snapshot with the given trailer, truncating a torn final record.
+// A missing log, or one based on another snapshot, is replaced by an empty log.
+func (journal *Journal) recover(base [snapshotTrailerSize]byte) error {
+	file, err := os.OpenFile(journal.logPath, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return journal.reset(base)
+	} else if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r := &countingByteReader{r: bufio.NewReader(file)}
+	name, logBase, err := readJournalHeader(r)
+	if err != nil {
+		file.Close()
+		return journal.error(err)
+	}
+	if logBase != base {
+		file.Close()
+		return journal.reset(base)
+	}
+	if journal.tree.Comparator == nil {
+		if keyType, found := utils.KeyTypeByName(name); found {
+			journal.tree.Comparator = keyType.Comparator
+		}
+	}
+	keyType, found := utils.KeyTypeOf(journal.tree.Comparator)
+	if !found {
+		file.Close()
+		return ErrNoKeyType
+	}
+	if keyType.Name != name {
+		file.Close()
+		return journal.error(fmt.Errorf("%w: %q", ErrJournalKeyType, name))
+	}
+	journal.keyType = keyType
+	offset, err := journal.replay(r, info.Size())
+	if err == nil && offset < info.Size() {
+		err = file.Truncate(offset)
+		if err == nil {
+			err = file.Sync()
+		}
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	journal.file = file
+	return nil
+}
+
+// readJournalHeader reads the header, a truncated header is reported as ErrJournalFormat.
+func readJournalHeader(r io.ByteReader) (name string, base [snapshotTrailerSize]byte, err error) {
+	br := &wire.Reader{R: r}
+	magic := br.Read(len(journalMagic))
+	version := br.Read(1)
+	if br.Err != nil || string(magic) != journalMagic || version[0] != journalVersion {
+		return "", base, ErrJournalFormat
+	}
+	name = string(br.ReadBytes())
+	copy(base[:], br.Read(snapshotTrailerSize))
+	if br.Err != nil {
+		return "", base, ErrJournalFormat
+	}
+	return name, base, nil
+}
+
+// replay applies the records read from r, which has already read the header of a log of size bytes,
+// and returns the offset after the last complete record.
+func (journal *Journal) replay(r *countingByteReader, size int64) (int64, error) {
+	var header [journalRecordSize]byte
+	var payload []byte
+	for {
+		offset := r.n
+		if size-offset < journalRecordSize {
+			return offset, nil // end of log or torn record
+		}
+		readFull(r, header[:])
+		lengthCRC := crc32.Checksum(header[0:4], castagnoli)
+		if lengthCRC != binary.LittleEndian.Uint32(header[4:]) {
+			return offset, journal.error(fmt.Errorf("%w: length checksum mismatch at offset %d", ErrJournalCorrupt, offset))
+		}
+		length := int64(binary.LittleEndian.Uint32(header[0:]))
+		end := offset + journalRecordSize + length
+		if end > size {
+			return offset, nil // torn final record
+		}
+		if int64(cap(payload)) < length {
+			payload = make([]byte, length)
+		}
+		payload = payload[:length]
+		readFull(r, payload)
+		if crc32.Update(lengthCRC, castagnoli, payload) != binary.LittleEndian.Uint32(header[8:]) {
+			if end == size {
+				return offset, nil // torn final record
+			}
+			return offset, journal.error(fmt.Errorf("%w: checksum mismatch at offset %d", ErrJournalCorrupt, offset))
+		}
+		if err := journal.apply(payload); err != nil {
+			return offset, journal.error(fmt.Errorf("%w: record at offset %d: %v", ErrJournalCorrupt, offset, err))
+		}
+	}
+}
+
+// readFull reads len(data) bytes known to be present.
+func readFull(r io.ByteReader, data []byte) {
+	for i := range data {
+		data[i], _ = r.ReadByte()
+	}
+}
+
+// apply applies the payload of a record to the tree.
+func (journal *Journal) apply(payload []byte) error {
+	if len(payload) == 0 {
+		return errors.New("empty record")
+	}
+	op, payload := payload[0], payload[1:]
+	switch op {
+	case journalPut:
+		n, length := binary.Uvarint(payload)
+		if length <= 0 || n == 0 || n > uint64(maxInt) {
+			return fmt.Errorf("invalid count")
+		}
+		key, err := journal.keyType.Codec.Decode(payload[length:])
+		if err != nil {
+			return err
+		}
+		journal.tree.PutN(key, int(n))
+	case journalRemove:
+		key, err := journal.keyType.Codec.Decode(payload)
+		if err != nil {
+			return err
+		}
+		journal.tree.Remove(key)
+	case journalClear:
+		if len(payload) != 0 {
+			return fmt.Errorf("invalid clear")
+		}
+		journal.tree.Clear()
+	default:
+		return fmt.Errorf("unknown operation %d", op)
+	}
+	return nil
+}
+
+// reset replaces the log by an empty one based on the snapshot with the given trailer.
+func (journal *Journal) reset(base [snapshotTrailerSize]byte) error {
+	keyType, found := utils.KeyTypeOf(journal.tree.Comparator)
+	if !found {
+		return ErrNoKeyType
+	}
+	journal.keyType = keyType
+	file, err := journal.create(base)
+	if err != nil {
+		return err
+	}
+	journal.file = file
+	return nil
+}
+
+// create atomically replaces the log by an empty one and returns it open for appending.
+func (journal *Journal) create(base [snapshotTrailerSize]byte) (*os.File, error) {
+	file, err := ioutil.TempFile(filepath.Dir(journal.logPath), filepath.Base(journal.logPath)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(journalMagic), journalVersion)
+	header = appendUvarint(header, uint64(len(journal.keyType.Name)))
+	header = append(header, journal.keyType.Name...)
+	header = append(header, base[:]...)
+	_, err = file.Write(header)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), journal.logPath)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	syncDir(filepath.Dir(journal.logPath))
+	return file, nil
+}
+
+func (journal *Journal) error(err error) error {
+	return &JournalError{Path: journal.logPath, Err: err}
+}
+
+func appendUvarint(data []byte, value uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutUvarint(buf[:], value)]...)
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestJournal(t *testing.T, dir string, options JournalOptions) *Journal {
+	journal, err := OpenJournal(NewWithIntComparator(), filepath.Join(dir, "tree.snap"), filepath.Join(dir, "tree.log"), options)
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	return journal
+}
+
+func TestRedBlackTreeJournalReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redblacktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, policy := range []SyncPolicy{SyncEveryOp, SyncInterval, SyncNever} {
+		journal := openTestJournal(t, dir, JournalOptions{Sync: policy, Interval: time.Millisecond})
+		journal.Clear()
+		journal.Put(5)
+		journal.PutN(3, 4)
+		journal.Put(7)
+		journal.Put(5)
+		if found, err := journal.Remove(3); !found || err != nil {
+			t.Errorf("Got %v %v expected true", found, err)
+		}
+		if found, err := journal.Remove(42); found || err != nil {
+			t.Errorf("Got %v %v expected false", found, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if err := journal.Close(); err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		if err := journal.Put(1); !errors.Is(err, ErrJournalClosed) {
+			t.Errorf("Got %v expected %v", err, ErrJournalClosed)
+		}
+
+		journal = openTestJournal(t, dir, JournalOptions{Sync: policy})
+		assertValidTree(t, journal.Tree())
+		if actualValue, expectedValue := fmt.Sprintf("%v", journal.Tree().Keys()), "[3 3 3 5 5 7]"; actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+		journal.Close()
+	}
+}
+
+func TestRedBlackTreeJournalTornRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redblacktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "tree.log")
+
+	journal := openTestJournal(t, dir, JournalOptions{Sync: SyncNever})
+	journal.Put(1)
+	journal.Put(2)
+	journal.Close()
+	valid, _ := ioutil.ReadFile(logPath)
+	complete := len(valid)
+
+	journal = openTestJournal(t, dir, JournalOptions{Sync: SyncNever})
+	journal.PutN(3, 1000)
+	journal.Close()
+	full, _ := ioutil.ReadFile(logPath)
+
+	torn := [][]byte{full[:complete+3], full[:len(full)-1], append(append([]byte(nil), full[:len(full)-1]...), full[len(full)-1]^0xff)}
+	for i, data := range torn {
+		ioutil.WriteFile(logPath, data, 0644)
+		journal = openTestJournal(t, dir, JournalOptions{})
+		if actualValue, expectedValue := fmt.Sprintf("%v", journal.Tree().Keys()), "[1 2]"; actualValue != expectedValue {
+			t.Errorf("%d: Got %v expected %v", i, actualValue, expectedValue)
+		}
+		journal.Put(4)
+		journal.Close()
+		journal = openTestJournal(t, dir, JournalOptions{})
+		if actualValue, expectedValue := fmt.Sprintf("%v", journal.Tree().Keys()), "[1 2 4]"; actualValue != expectedValue {
+			t.Errorf("%d: Got %v expected %v", i, actualValue, expectedValue)
+		}
+		journal.Close()
+	}
+
+	corrupt := append([]byte(nil), full...)
+	corrupt[complete-1] ^= 0xff
+	ioutil.WriteFile(logPath, corrupt, 0644)
+	_, err = OpenJournal(NewWithIntComparator(), filepath.Join(dir, "tree.snap"), logPath, JournalOptions{})
+	var journalErr *JournalError
+	if !errors.Is(err, ErrJournalCorrupt) || !errors.As(err, &journalErr) || journalErr.Path != logPath {
+		t.Errorf("Got %v expected %v", err, ErrJournalCorrupt)
+	}
+
+	// a corrupt length of the first record is not mistaken for a torn final record
+	corrupt = append([]byte(nil), full...)
+	corrupt[complete-2*(journalRecordSize+3)] ^= 0xff
+	ioutil.WriteFile(logPath, corrupt, 0644)
+	_, err = OpenJournal(NewWithIntComparator(), filepath.Join(dir, "tree.snap"), logPath, JournalOptions{})
+	if !errors.Is(err, ErrJournalCorrupt) || !strings.Contains(err.Error(), "length checksum") {
+		t.Errorf("Got %v expected %v", err, ErrJournalCorrupt)
+	}
+
+	ioutil.WriteFile(logPath, full, 0644)
+	if _, err := OpenJournal(NewWithStringComparator(), filepath.Join(dir, "tree.snap"), logPath, JournalOptions{}); !errors.Is(err, ErrJournalKeyType) {
+		t.Errorf("Got %v expected %v", err, ErrJournalKeyType)
+	}
+	ioutil.WriteFile(logPath, []byte("not a journal"), 0644)
+	if _, err := OpenJournal(NewWithIntComparator(), filepath.Join(dir, "tree.snap"), logPath, JournalOptions{}); !errors.Is(err, ErrJournalFormat) {
+		t.Errorf("Got %v expected %v", err, ErrJournalFormat)
+	}
+}
+
+func TestRedBlackTreeJournalCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redblacktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "tree.log")
+
+	journal := openTestJournal(t, dir, JournalOptions{})
+	for i := 0; i < 100; i++ {
+		journal.Put(i % 10)
+	}
+	before, _ := os.Stat(logPath)
+	if err := journal.Compact(); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	after, _ := os.Stat(logPath)
+	if before.Size() <= after.Size() {
+		t.Errorf("Got log size %v expected less than %v", after.Size(), before.Size())
+	}
+	journal.Remove(0)
+	journal.Close()
+
+	tree := &Tree{}
+	journal, err = OpenJournal(tree, filepath.Join(dir, "tree.snap"), logPath, JournalOptions{})
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := tree.Size(), 99; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	// A crash after writing the snapshot but before replacing the log must not replay the log twice.
+	journal.Put(42)
+	journal.Close()
+	stale, _ := ioutil.ReadFile(logPath)
+	journal = openTestJournal(t, dir, JournalOptions{})
+	journal.Compact()
+	journal.Close()
+	ioutil.WriteFile(logPath, stale, 0644)
+	journal = openTestJournal(t, dir, JournalOptions{})
+	if actualValue, expectedValue := journal.Tree().Size(), 100; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	journal.Close()
+
+	files, _ := ioutil.ReadDir(dir)
+	if actualValue, expectedValue := len(files), 2; actualValue != expectedValue {
+		t.Errorf("Got %v files expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeJournalCompactFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redblacktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	snapshotPath, logDir := filepath.Join(dir, "tree.snap"), filepath.Join(dir, "log")
+	os.Mkdir(logDir, 0755)
+	logPath := filepath.Join(logDir, "tree.log")
+
+	journal, err := OpenJournal(NewWithIntComparator(), snapshotPath, logPath, JournalOptions{})
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	journal.Put(1)
+	// the snapshot is written but the log cannot be replaced
+	os.RemoveAll(logDir)
+	if err := journal.Compact(); err == nil {
+		t.Fatalf("Expected error replacing the log")
+	}
+	if err := journal.Put(2); err == nil {
+		t.Errorf("Expected writes to fail after a failed compaction")
+	}
+	journal.Close()
+
+	os.Mkdir(logDir, 0755)
+	tree := &Tree{}
+	if journal, err = OpenJournal(tree, snapshotPath, logPath, JournalOptions{}); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	defer journal.Close()
+	if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[1]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeJournalConcurrentClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redblacktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journal := openTestJournal(t, dir, JournalOptions{Sync: SyncInterval, Interval: time.Millisecond})
+	journal.Put(1)
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- journal.Close() }()
+	}
+	closed := 0
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err == nil {
+			closed++
+		} else if !errors.Is(err, ErrJournalClosed) {
+			t.Errorf("Got %v expected %v", err, ErrJournalClosed)
+		}
+	}
+	if closed != 1 {
+		t.Errorf("Got %v successful closes expected 1", closed)
+	}
+}
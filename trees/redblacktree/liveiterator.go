@@ -0,0 +1,126 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import "errors"
+
+// ErrConcurrentModification is reported by a fail-fast LiveIterator when the tree was modified during iteration.
+var ErrConcurrentModification = errors.New("redblacktree: tree modified during iteration")
+
+// LiveIterator is an iterator over distinct keys that remains valid while the tree is being modified.
+//
+// Unlike Iterator it never dereferences a node after the tree has changed: when a modification is
+// detected it re-seeks in O(log n) to the key following (or preceding) the last returned key,
+// or, if fail-fast, stops and reports ErrConcurrentModification through Err().
+type LiveIterator struct {
+	tree          *Tree
+	node          *Node
+	position      position
+	key           interface{}
+	count         int
+	modifications uint64
+	failFast      bool
+	err           error
+}
+
+// LiveIterator returns an iterator that transparently re-seeks after the tree is modified.
+func (tree *Tree) LiveIterator() LiveIterator {
+	return LiveIterator{tree: tree, position: begin, modifications: tree.modifications}
+}
+
+// FailFastIterator returns an iterator that stops with ErrConcurrentModification once the tree is modified.
+func (tree *Tree) FailFastIterator() LiveIterator {
+	return LiveIterator{tree: tree, position: begin, modifications: tree.modifications, failFast: true}
+}
+
+// Next moves the iterator to the next key and returns true if there was one.
+// If the tree was modified since the last call, the next key is the smallest key larger than the last returned key.
+func (iterator *LiveIterator) Next() bool {
+	if iterator.err != nil || iterator.position == end {
+		return false
+	}
+	var node *Node
+	switch {
+	case iterator.position == begin:
+		node = iterator.tree.Left()
+	case !iterator.modified():
+		node = iterator.node.successor()
+	case iterator.failFast:
+		return iterator.fail()
+	default:
+		node = iterator.tree.higher(iterator.key)
+	}
+	if node == nil {
+		iterator.reset(end)
+		return false
+	}
+	iterator.move(node)
+	return true
+}
+
+// Prev moves the iterator to the previous key and returns true if there was one.
+// If the tree was modified since the last call, the previous key is the largest key smaller than the last returned key.
+func (iterator *LiveIterator) Prev() bool {
+	if iterator.err != nil || iterator.position == begin {
+		return false
+	}
+	var node *Node
+	switch {
+	case iterator.position == end:
+		node = iterator.tree.Right()
+	case !iterator.modified():
+		node = iterator.node.predecessor()
+	case iterator.failFast:
+		return iterator.fail()
+	default:
+		node = iterator.tree.lower(iterator.key)
+	}
+	if node == nil {
+		iterator.reset(begin)
+		return false
+	}
+	iterator.move(node)
+	return true
+}
+
+// Key returns the last returned key.
+func (iterator *LiveIterator) Key() interface{} {
+	return iterator.key
+}
+
+// Count returns the number of repetitions of the last returned key at the time it was returned.
+func (iterator *LiveIterator) Count() int {
+	return iterator.count
+}
+
+// Err returns ErrConcurrentModification if a fail-fast iterator stopped because the tree was modified.
+func (iterator *LiveIterator) Err() error {
+	return iterator.err
+}
+
+func (iterator *LiveIterator) modified() bool {
+	return iterator.modifications != iterator.tree.modifications
+}
+
+func (iterator *LiveIterator) move(node *Node) {
+	iterator.node = node
+	iterator.position = between
+	iterator.key = node.Key
+	iterator.count = node.NumRepeated + 1
+	iterator.modifications = iterator.tree.modifications
+}
+
+func (iterator *LiveIterator) reset(position position) {
+	iterator.node = nil
+	iterator.position = position
+	iterator.key = nil
+	iterator.count = 0
+}
+
+func (iterator *LiveIterator) fail() bool {
+	iterator.err = ErrConcurrentModification
+	iterator.reset(end)
+	return false
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRedBlackTreeLiveIteratorUnmodified(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{3, 1, 2, 2} {
+		tree.Put(key)
+	}
+	it := tree.LiveIterator()
+	var keys []interface{}
+	for it.Next() {
+		keys = append(keys, fmt.Sprintf("%v:%v", it.Key(), it.Count()))
+	}
+	for it.Prev() {
+		keys = append(keys, it.Key())
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", keys), "[1:1 2:2 3:1 3 2 1]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeLiveIteratorModified(t *testing.T) {
+	tree := NewWithIntComparator()
+	for i := 0; i < 10; i++ {
+		tree.Put(i)
+	}
+	it := tree.LiveIterator()
+	var keys []interface{}
+	for it.Next() {
+		key := it.Key().(int)
+		keys = append(keys, key)
+		switch key {
+		case 2:
+			tree.Remove(2) // remove current key, which has two children
+			tree.Remove(3)
+		case 5:
+			tree.Put(6)
+			tree.Put(5)
+		case 7:
+			tree.Clear()
+			tree.Put(1)
+			tree.Put(9)
+		}
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", keys), "[0 1 2 4 5 6 7 9]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+
+	it = tree.LiveIterator()
+	it.Next()
+	tree.Put(0)
+	if !it.Prev() || it.Key() != 0 {
+		t.Errorf("Got %v expected %v", it.Key(), 0)
+	}
+}
+
+func TestRedBlackTreeFailFastIterator(t *testing.T) {
+	tree := NewWithIntComparator()
+	for i := 0; i < 5; i++ {
+		tree.Put(i)
+	}
+	it := tree.FailFastIterator()
+	count := 0
+	for it.Next() {
+		count++
+		if it.Key() == 2 {
+			tree.Remove(4)
+		}
+	}
+	if actualValue, expectedValue := count, 3; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if actualValue, expectedValue := it.Err(), ErrConcurrentModification; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if it.Next() || it.Prev() {
+		t.Errorf("Shouldn't iterate after failure")
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"container/heap"
+	"fmt"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// MergeOptions configures MergeSnapshots.
+type MergeOptions struct {
+	// Filter, if not nil, keeps only the keys it returns true for.
+	Filter func(key interface{}) bool
+	// MinCount drops keys whose summed count is smaller.
+	MinCount int
+}
+
+// MergeSnapshots writes the snapshot at dst holding every key of the snapshots at srcs with the sum of its counts.
+// The inputs are merged in one pass reading an entry of each at a time, so memory is proportional to len(srcs).
+// All inputs must have the same key type, whose registered comparator orders the keys.
+//
+// The output is written like SaveSnapshot and replaced only if all inputs were read and verified.
+// Errors with an input are *SnapshotError.
+func MergeSnapshots(dst string, srcs []string, options MergeOptions) error {
+	sources := make([]*mergeSource, 0, len(srcs))
+	defer func() {
+		for _, source := range sources {
+			source.file.Close()
+		}
+	}()
+	keyEncoding := binaryKeysDelta
+	var keyType utils.KeyType
+	for i, src := range srcs {
+		sr, err := openSnapshot(src)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, &mergeSource{snapshotReader: sr})
+		if i == 0 {
+			keyType = sr.decoder.keyType
+		} else if sr.decoder.keyType.Name != keyType.Name {
+			return sr.error(fmt.Errorf("%w: %q, expected %q", ErrSnapshotKeyType, sr.decoder.keyType.Name, keyType.Name))
+		}
+		if sr.decoder.keyEncoding != binaryKeysDelta {
+			keyEncoding = binaryKeysCodec
+		}
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("redblacktree: no snapshots to merge")
+	}
+	ordinal, _ := keyType.Codec.(utils.OrdinalKeyCodec)
+	var prev uint64
+
+	sw, err := createSnapshot(dst, keyType, keyEncoding)
+	if err != nil {
+		return err
+	}
+	err = mergeEntries(sources, keyType.Comparator, func(entry Entry) error {
+		if entry.Count < options.MinCount || options.Filter != nil && !options.Filter(entry.Key) {
+			return nil
+		}
+		if keyEncoding == binaryKeysDelta {
+			key := ordinal.Ordinal(entry.Key)
+			if sw.distinct > 0 && key <= prev {
+				return fmt.Errorf("redblacktree: comparator does not order key %v by its ordinal", entry.Key)
+			}
+			prev = key
+		}
+		return sw.write(entry)
+	})
+	if err != nil {
+		sw.abort()
+		return err
+	}
+	return sw.commit()
+}
+
+// mergeSource is a snapshot being merged with its current entry.
+type mergeSource struct {
+	*snapshotReader
+	entry Entry
+	read  uint64 // number of entries read
+	size  uint64 // number of elements read
+}
+
+// advance reads the next entry, returning false at the end of the snapshot once it is verified.
+func (source *mergeSource) advance(comparator utils.Comparator) (bool, error) {
+	if source.read == source.distinct {
+		if err := source.verify(); err != nil {
+			return false, err
+		}
+		if source.size != source.snapshotReader.size {
+			return false, source.error(fmt.Errorf("%w: %d elements recorded but %d read", ErrSnapshotCorrupt, source.snapshotReader.size, source.size))
+		}
+		return false, nil
+	}
+	entry, err := source.next()
+	if err == nil && entry.Count <= 0 {
+		err = fmt.Errorf("entry %d: count of key %v must be positive, got %d", source.read, entry.Key, entry.Count)
+	}
+	if err == nil && source.read > 0 && comparator(source.entry.Key, entry.Key) >= 0 {
+		err = fmt.Errorf("entry %d: key %v is not sorted after %v", source.read, entry.Key, source.entry.Key)
+	}
+	if err != nil {
+		return false, source.error(err)
+	}
+	source.entry = entry
+	source.read++
+	source.size += uint64(entry.Count)
+	return true, nil
+}
+
+// mergeEntries calls write for every key of the sources in-order with the sum of its counts.
+func mergeEntries(sources []*mergeSource, comparator utils.Comparator, write func(Entry) error) error {
+	h := &mergeSourceHeap{comparator: comparator}
+	for _, source := range sources {
+		ok, err := source.advance(comparator)
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.sources = append(h.sources, source)
+		}
+	}
+	heap.Init(h)
+	for len(h.sources) > 0 {
+		entry := Entry{Key: h.sources[0].entry.Key}
+		for len(h.sources) > 0 && comparator(h.sources[0].entry.Key, entry.Key) == 0 {
+			source := h.sources[0]
+			if entry.Count > maxInt-source.entry.Count {
+				return fmt.Errorf("redblacktree: count of key %v overflows int", entry.Key)
+			}
+			entry.Count += source.entry.Count
+			ok, err := source.advance(comparator)
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(h, 0)
+			} else {
+				heap.Pop(h)
+			}
+		}
+		if err := write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeSourceHeap orders the sources by their current keys, it implements heap.Interface.
+type mergeSourceHeap struct {
+	comparator utils.Comparator
+	sources    []*mergeSource
+}
+
+func (h *mergeSourceHeap) Len() int { return len(h.sources) }
+
+func (h *mergeSourceHeap) Less(i, j int) bool {
+	return h.comparator(h.sources[i].entry.Key, h.sources[j].entry.Key) < 0
+}
+
+func (h *mergeSourceHeap) Swap(i, j int) { h.sources[i], h.sources[j] = h.sources[j], h.sources[i] }
+
+func (h *mergeSourceHeap) Push(x interface{}) { h.sources = append(h.sources, x.(*mergeSource)) }
+
+func (h *mergeSourceHeap) Pop() interface{} {
+	source := h.sources[len(h.sources)-1]
+	h.sources = h.sources[:len(h.sources)-1]
+	return source
+}
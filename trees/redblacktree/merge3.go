@@ -0,0 +1,116 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import "fmt"
+
+// ConflictKind classifies a conflict of a three-way merge.
+type ConflictKind int
+
+const (
+	// ConflictNegative is a merged count below zero, both sides removed more occurrences than there are.
+	ConflictNegative ConflictKind = iota
+	// ConflictBothRemoved is a key of the base removed on both sides.
+	ConflictBothRemoved
+	// ConflictRemovedChanged is a key of the base removed on one side and its count changed on the other.
+	ConflictRemovedChanged
+)
+
+// Conflict is a key whose three-way merge needs a decision, counts are zero for missing keys.
+type Conflict struct {
+	Kind   ConflictKind
+	Key    interface{}
+	Base   int
+	Ours   int
+	Theirs int
+	Merged int // base + (ours - base) + (theirs - base)
+}
+
+// ConflictPolicy returns the count to keep for a conflicting key, the key is dropped if it is not positive.
+type ConflictPolicy func(conflict Conflict) int
+
+// ClampConflicts keeps the merged count, or removes the key if it is negative.
+func ClampConflicts(conflict Conflict) int {
+	if conflict.Merged < 0 {
+		return 0
+	}
+	return conflict.Merged
+}
+
+// OursConflicts keeps our count of conflicting keys.
+func OursConflicts(conflict Conflict) int {
+	return conflict.Ours
+}
+
+// TheirsConflicts keeps their count of conflicting keys.
+func TheirsConflicts(conflict Conflict) int {
+	return conflict.Theirs
+}
+
+// Merge3 merges the changes that ours and theirs made to base: every key gets the count
+// base + (ours - base) + (theirs - base). Conflicting keys, see ConflictKind, are resolved by policy,
+// ClampConflicts if nil, and reported in-order.
+//
+// The trees are merged in one in-order pass and the result is built in O(n), n being the number of
+// distinct keys of the three trees. The result uses ours' comparator, which must order all trees the same way,
+// otherwise an error is returned.
+func Merge3(base, ours, theirs *Tree, policy ConflictPolicy) (*Tree, []Conflict, error) {
+	if policy == nil {
+		policy = ClampConflicts
+	}
+	comparator := ours.Comparator
+	var entries []Entry
+	var conflicts []Conflict
+	var key interface{}
+	// count returns the count of key in the tree of node and advances node past it
+	count := func(node **Node) int {
+		if *node == nil || comparator((*node).Key, key) != 0 {
+			return 0
+		}
+		n := (*node).NumRepeated + 1
+		*node = (*node).successor()
+		return n
+	}
+	b, o, t := base.Left(), ours.Left(), theirs.Left()
+	for b != nil || o != nil || t != nil {
+		// the smallest current key of the three trees
+		key = nil
+		for _, node := range []*Node{b, o, t} {
+			if node != nil && (key == nil || comparator(node.Key, key) < 0) {
+				key = node.Key
+			}
+		}
+		c := Conflict{Key: key, Base: count(&b), Ours: count(&o), Theirs: count(&t)}
+		c.Merged = c.Ours + c.Theirs - c.Base
+		merged, conflicting := c.Merged, true
+		switch {
+		case c.Base > 0 && c.Ours == 0 && c.Theirs == 0:
+			c.Kind = ConflictBothRemoved
+		case c.Base > 0 && (c.Ours == 0 && c.Theirs != c.Base || c.Theirs == 0 && c.Ours != c.Base):
+			c.Kind = ConflictRemovedChanged
+		case c.Merged < 0:
+			c.Kind = ConflictNegative
+		default:
+			conflicting = false
+		}
+		if conflicting {
+			conflicts = append(conflicts, c)
+			merged = policy(c)
+		}
+		if merged > 0 {
+			entries = append(entries, Entry{Key: key, Count: merged})
+		}
+	}
+	tree := NewWith(comparator)
+	index := 0
+	err := tree.buildSorted(len(entries), func() (Entry, error) {
+		index++
+		return entries[index-1], nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("redblacktree: trees are not ordered by the same comparator: %w", err)
+	}
+	return tree, conflicts, nil
+}
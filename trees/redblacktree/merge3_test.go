@@ -0,0 +1,84 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func TestRedBlackTreeMerge3(t *testing.T) {
+	base, ours, theirs := NewWithIntComparator(), NewWithIntComparator(), NewWithIntComparator()
+	for _, key := range []int{1, 1, 2, 2, 3, 3, 3, 4, 5, 5, 5, 5, 6, 6} {
+		base.Put(key)
+	}
+	for _, key := range []int{1, 1, 1, 2, 2, 3, 5, 5, 5, 5, 7} {
+		ours.Put(key)
+	}
+	for _, key := range []int{1, 1, 2, 2, 2, 2, 2, 3, 5, 5, 5, 5, 5, 5, 8, 8} {
+		theirs.Put(key)
+	}
+
+	merged, conflicts, err := Merge3(base, ours, theirs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertValidTree(t, merged)
+	// 1: ours +1, 2: theirs +3, 3: both -2 is -1, 4: both removed, 5: theirs +2, 6: both removed, 7 and 8 added
+	if actualValue, expectedValue := fmt.Sprintf("%v", merged.Keys()), "[1 1 1 2 2 2 2 2 5 5 5 5 5 5 7 8 8]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	expected := "[{0 3 3 1 1 -1} {1 4 1 0 0 -1} {1 6 2 0 0 -2}]"
+	if actualValue := fmt.Sprintf("%v", conflicts); actualValue != expected {
+		t.Errorf("Got %v expected %v", actualValue, expected)
+	}
+
+	ours, theirs = NewWithIntComparator(), NewWithIntComparator()
+	for _, key := range []int{1, 1, 2, 2, 2} {
+		ours.Put(key)
+	}
+	for _, key := range []int{1, 1, 3, 3, 3, 4, 5, 5, 5, 5, 6, 6} {
+		theirs.Put(key)
+	}
+	tests := []struct {
+		policy ConflictPolicy
+		keys   string
+	}{
+		{nil, "[1 1 2]"},
+		{OursConflicts, "[1 1 2 2 2]"},
+		{TheirsConflicts, "[1 1]"},
+		{func(conflict Conflict) int { return conflict.Base }, "[1 1 2 2]"},
+	}
+	for _, test := range tests {
+		merged, conflicts, err := Merge3(base, ours, theirs, test.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actualValue := fmt.Sprintf("%v", merged.Keys()); actualValue != test.keys {
+			t.Errorf("Got %v expected %v", actualValue, test.keys)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", conflicts), "[{2 2 2 3 0 1}]"; actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+
+	empty := NewWithIntComparator()
+	if merged, conflicts, err := Merge3(empty, empty, empty, nil); err != nil || !merged.Empty() || len(conflicts) != 0 {
+		t.Errorf("Got %v %v %v expected empty merge", merged, conflicts, err)
+	}
+
+	// theirs is ordered the other way round, the merged keys come out of order
+	reversed := NewWith(func(a, b interface{}) int { return utils.IntComparator(b, a) })
+	reversed.Put(1)
+	reversed.Put(2)
+	reversed.Put(3)
+	ours = NewWithIntComparator()
+	ours.Put(2)
+	if merged, _, err := Merge3(empty, ours, reversed, nil); err == nil {
+		t.Errorf("Got %v expected an error", merged)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedBlackTreeMergeSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redblacktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	expected := NewWithIntComparator()
+	var srcs []string
+	for i := 0; i < 5; i++ {
+		tree := NewWithIntComparator()
+		for key := i; key < 500; key += i + 1 {
+			tree.PutN(key, i+1)
+			expected.PutN(key, i+1)
+		}
+		srcs = append(srcs, filepath.Join(dir, fmt.Sprintf("%d.snap", i)))
+		if err := tree.SaveSnapshot(srcs[i]); err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+	}
+	srcs = append(srcs, srcs[0])
+	expected.PutN(0, 1)
+	for key := 1; key < 500; key++ {
+		expected.PutN(key, 1)
+	}
+
+	dst := filepath.Join(dir, "merged.snap")
+	if err := MergeSnapshots(dst, srcs, MergeOptions{}); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	merged := &Tree{}
+	if err := merged.LoadSnapshot(dst); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	assertValidTree(t, merged)
+	if actualValue, expectedValue := fmt.Sprintf("%v", merged.Keys()), fmt.Sprintf("%v", expected.Keys()); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	options := MergeOptions{MinCount: 5, Filter: func(key interface{}) bool { return key.(int) < 100 }}
+	if err := MergeSnapshots(dst, srcs, options); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if err := merged.LoadSnapshot(dst); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	size := 0
+	for node := expected.Left(); node != nil && node.Key.(int) < 100; node = node.successor() {
+		if node.NumRepeated+1 >= 5 {
+			size += node.NumRepeated + 1
+		}
+	}
+	if actualValue, expectedValue := merged.Size(), size; actualValue != expectedValue || size == 0 {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeMergeSnapshotsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redblacktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ints, strs, dst := filepath.Join(dir, "ints.snap"), filepath.Join(dir, "strs.snap"), filepath.Join(dir, "merged.snap")
+	tree := NewWithIntComparator()
+	for i := 0; i < 100; i++ {
+		tree.PutN(i*7-100, i%5+1)
+	}
+	if err := tree.SaveSnapshot(ints); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	tree = NewWithStringComparator()
+	tree.Put("a")
+	if err := tree.SaveSnapshot(strs); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+
+	if err := MergeSnapshots(dst, []string{ints, strs}, MergeOptions{}); !errors.Is(err, ErrSnapshotKeyType) {
+		t.Errorf("Got %v expected %v", err, ErrSnapshotKeyType)
+	}
+	data, _ := ioutil.ReadFile(ints)
+	data[len(data)/2] ^= 0x10
+	ioutil.WriteFile(ints, data, 0644)
+	var snapshotErr *SnapshotError
+	if err := MergeSnapshots(dst, []string{strs, ints}, MergeOptions{}); !errors.As(err, &snapshotErr) || snapshotErr.Path != ints {
+		t.Errorf("Got %v expected error with %v", err, ints)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if actualValue, expectedValue := len(files), 2; actualValue != expectedValue {
+		t.Errorf("Got %v files expected %v", actualValue, expectedValue)
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !redblacktreedebug
+// +build !redblacktreedebug
+
+package redblacktree
+
+// debug validates the tree after every mutation, see Validate.
+const debug = false
@@ -0,0 +1,95 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import "fmt"
+
+// Observer is notified of the operations of a tree, see SetObserver.
+// Its methods are called synchronously and must not modify the tree.
+type Observer interface {
+	// Put is called after n repetitions of key were inserted by Put or PutN.
+	Put(key interface{}, n int)
+	// Remove is called after n repetitions of key were removed by Remove or RemoveN.
+	Remove(key interface{}, n int)
+	// Rotate is called before node is rotated down to the left or to the right.
+	Rotate(node *Node, left bool)
+	// Rebalance is called after a node was inserted or a black node removed with the number of levels
+	// climbed towards the root to restore the red-black properties.
+	Rebalance(depth int)
+	// UpdateCounts is called after a count changed or a node was inserted or removed with the number of
+	// ancestors whose NumChildren were updated on the path to the root. NumChildren recomputed
+	// by rotations are not included; see Rotate.
+	UpdateCounts(steps int)
+	// Compare is called before the tree's comparator is invoked.
+	Compare(a, b interface{})
+}
+
+// SetObserver notifies observer of the tree's operations, nil stops notifying.
+// An unobserved tree only pays a nil check per operation.
+func (tree *Tree) SetObserver(observer Observer) {
+	tree.observer = observer
+	tree.rebalanceDepth = 0
+}
+
+// Counters is an Observer summarizing the operations of a tree as counters.
+type Counters struct {
+	Puts              uint64 // number of insertions of one or more repetitions of a key
+	Removes           uint64 // number of removals of one or more repetitions of a key
+	Rotations         uint64
+	Rebalances        uint64 // number of rebalancings after inserting or removing a node
+	RebalanceDepth    uint64 // total number of levels climbed by rebalancings
+	MaxRebalanceDepth int
+	CountUpdates      uint64 // total number of ancestors' NumChildren updated, excluding rotations
+	Comparisons       uint64
+}
+
+// Put implements Observer.
+func (counters *Counters) Put(key interface{}, n int) { counters.Puts++ }
+
+// Remove implements Observer.
+func (counters *Counters) Remove(key interface{}, n int) { counters.Removes++ }
+
+// Rotate implements Observer.
+func (counters *Counters) Rotate(node *Node, left bool) { counters.Rotations++ }
+
+// Rebalance implements Observer.
+func (counters *Counters) Rebalance(depth int) {
+	counters.Rebalances++
+	counters.RebalanceDepth += uint64(depth)
+	if depth > counters.MaxRebalanceDepth {
+		counters.MaxRebalanceDepth = depth
+	}
+}
+
+// UpdateCounts implements Observer.
+func (counters *Counters) UpdateCounts(steps int) { counters.CountUpdates += uint64(steps) }
+
+// Compare implements Observer.
+func (counters *Counters) Compare(a, b interface{}) { counters.Comparisons++ }
+
+// Reset sets all counters to zero.
+func (counters *Counters) Reset() {
+	*counters = Counters{}
+}
+
+// String returns the counters with averages per operation.
+func (counters *Counters) String() string {
+	operations := counters.Puts + counters.Removes
+	return fmt.Sprintf("puts %d, removes %d, comparisons %d (%.2f/op), rotations %d (%.2f/op), "+
+		"rebalances %d (depth %.2f avg, %d max), count updates %d (%.2f/op)",
+		counters.Puts, counters.Removes,
+		counters.Comparisons, perOperation(counters.Comparisons, operations),
+		counters.Rotations, perOperation(counters.Rotations, operations),
+		counters.Rebalances, perOperation(counters.RebalanceDepth, counters.Rebalances), counters.MaxRebalanceDepth,
+		counters.CountUpdates, perOperation(counters.CountUpdates, operations))
+}
+
+// perOperation returns total divided by operations, zero if there are none.
+func perOperation(total, operations uint64) float64 {
+	if operations == 0 {
+		return 0
+	}
+	return float64(total) / float64(operations)
+}
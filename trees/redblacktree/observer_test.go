@@ -0,0 +1,118 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// recordingObserver records the calls of the tree.
+type recordingObserver struct {
+	Counters
+	calls []string
+}
+
+func (observer *recordingObserver) Put(key interface{}, n int) {
+	observer.Counters.Put(key, n)
+	observer.calls = append(observer.calls, "put "+utils.ToString(key)+" "+utils.ToString(n))
+}
+
+func (observer *recordingObserver) Remove(key interface{}, n int) {
+	observer.Counters.Remove(key, n)
+	observer.calls = append(observer.calls, "remove "+utils.ToString(key)+" "+utils.ToString(n))
+}
+
+func (observer *recordingObserver) Rotate(node *Node, left bool) {
+	observer.Counters.Rotate(node, left)
+	direction := "right"
+	if left {
+		direction = "left"
+	}
+	observer.calls = append(observer.calls, "rotate "+utils.ToString(node.Key)+" "+direction)
+}
+
+func TestRedBlackTreeObserver(t *testing.T) {
+	tree := NewWithIntComparator()
+	observer := &recordingObserver{}
+	tree.SetObserver(observer)
+	tree.Put(1)
+	tree.Put(2)
+	tree.PutN(3, 2)
+	tree.PutN(3, 0)
+	tree.Put(3)
+	tree.RemoveN(3, 2)
+	tree.Remove(4)
+	tree.RemoveN(3, 5)
+	expected := []string{"put 1 1", "put 2 1", "rotate 1 left", "put 3 2", "put 3 1", "remove 3 2", "remove 3 1"}
+	if strings.Join(observer.calls, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Got %v expected %v", observer.calls, expected)
+	}
+	if observer.Puts != 4 || observer.Removes != 2 || observer.Rotations != 1 {
+		t.Errorf("Got %+v", observer.Counters)
+	}
+	// every insertion stops at its node, removing the red leaf 3 needs no rebalancing
+	if observer.Rebalances != 3 || observer.RebalanceDepth != 3 || observer.MaxRebalanceDepth != 1 {
+		t.Errorf("Got %+v", observer.Counters)
+	}
+
+	tree.SetObserver(nil)
+	tree.Put(4)
+	if observer.Puts != 4 {
+		t.Errorf("Got %v puts after removing the observer", observer.Puts)
+	}
+}
+
+func TestRedBlackTreeObserverCounters(t *testing.T) {
+	var comparisons uint64
+	tree := NewWith(func(a, b interface{}) int {
+		comparisons++
+		return utils.IntComparator(a, b)
+	})
+	counters := &Counters{}
+	tree.SetObserver(counters)
+	random := rand.New(rand.NewSource(1))
+	var puts, removes uint64
+	for i := 0; i < 2000; i++ {
+		key := random.Intn(200)
+		if random.Intn(3) == 0 {
+			if tree.RemoveN(key, random.Intn(3)+1) > 0 {
+				removes++
+			}
+		} else {
+			tree.PutN(key, random.Intn(3)+1)
+			puts++
+		}
+	}
+	// debug builds also compare keys when validating
+	if !debug && counters.Comparisons != comparisons {
+		t.Errorf("Got %v comparisons expected %v", counters.Comparisons, comparisons)
+	}
+	assertValidTree(t, tree)
+	if counters.Puts != puts || counters.Removes != removes {
+		t.Errorf("Got %v puts and %v removes expected %v and %v", counters.Puts, counters.Removes, puts, removes)
+	}
+	if counters.Comparisons == 0 || counters.Rotations == 0 || counters.Rebalances == 0 || counters.CountUpdates == 0 {
+		t.Errorf("Got %+v", counters)
+	}
+	if stats := tree.Stats(); counters.MaxRebalanceDepth > stats.Height {
+		t.Errorf("Got max rebalance depth %v above height %v", counters.MaxRebalanceDepth, stats.Height)
+	}
+	if !strings.HasPrefix(counters.String(), "puts ") {
+		t.Errorf("Got %q", counters.String())
+	}
+
+	counters.Reset()
+	if *counters != (Counters{}) {
+		t.Errorf("Got %+v after Reset", counters)
+	}
+	tree.Put(1000)
+	if counters.Comparisons == 0 || counters.Comparisons > uint64(tree.Stats().Height) {
+		t.Errorf("Got %v comparisons for one insertion", counters.Comparisons)
+	}
+}
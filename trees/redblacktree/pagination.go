@@ -0,0 +1,117 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Entry is a key together with the number of its repetitions.
+type Entry struct {
+	Key   interface{}
+	Count int
+}
+
+// Cursor marks a position between two elements of the tree for pagination.
+// It holds the last returned key and how many of its repetitions were returned,
+// so it stays meaningful across Put and Remove calls between pages.
+//
+// The zero Cursor is positioned before the first element.
+type Cursor struct {
+	Key    interface{}
+	Offset int
+}
+
+// Page returns up to limit elements following the cursor, grouped into entries of equal keys,
+// together with the cursor positioned after the last returned element.
+// A key whose repetitions do not fit into the page is continued on the next page.
+// Fewer than limit elements are returned only once the end of the tree is reached.
+func (tree *Tree) Page(after Cursor, limit int) ([]Entry, Cursor) {
+	var entries []Entry
+	var node *Node
+	skip := 0
+	if after.Key == nil {
+		node = tree.Left()
+	} else {
+		node, _ = tree.Ceiling(after.Key)
+		if node != nil && tree.compare(after.Key, node.Key) == 0 {
+			skip = after.Offset
+		}
+	}
+	for ; node != nil && limit > 0; node, skip = node.successor(), 0 {
+		available := node.NumRepeated + 1 - skip
+		if available <= 0 {
+			continue
+		}
+		take := available
+		if take > limit {
+			take = limit
+		}
+		entries = append(entries, Entry{Key: node.Key, Count: take})
+		after = Cursor{Key: node.Key, Offset: skip + take}
+		limit -= take
+	}
+	return entries, after
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding the cursor into a compact URL-safe token,
+// see ParseCursor. Keys are encoded with encoding/json, which fails for keys such as an infinite float.
+func (cursor Cursor) MarshalText() ([]byte, error) {
+	data, err := json.Marshal([]interface{}{cursor.Offset, cursor.Key})
+	if err != nil {
+		return nil, fmt.Errorf("redblacktree: cannot encode cursor key %v: %v", cursor.Key, err)
+	}
+	token := make([]byte, base64.RawURLEncoding.EncodedLen(len(data)))
+	base64.RawURLEncoding.Encode(token, data)
+	return token, nil
+}
+
+// String returns the token of the cursor, see MarshalText.
+// If the key cannot be encoded it returns the error message, which ParseCursor rejects.
+func (cursor Cursor) String() string {
+	token, err := cursor.MarshalText()
+	if err != nil {
+		return err.Error()
+	}
+	return string(token)
+}
+
+// ParseCursor decodes a token produced by Cursor.MarshalText or Cursor.String.
+// The key is decoded into the type registered for the tree's comparator, see utils.RegisterKeyType,
+// or else into the type of the keys currently stored in the tree.
+// Returns ErrNoKeyType if the token holds a key but neither is available.
+func (tree *Tree) ParseCursor(token string) (Cursor, error) {
+	if token == "" {
+		return Cursor{}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("redblacktree: invalid cursor: %v", err)
+	}
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) != 2 {
+		return Cursor{}, fmt.Errorf("redblacktree: invalid cursor %q", token)
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(fields[0], &cursor.Offset); err != nil || cursor.Offset < 0 {
+		return Cursor{}, fmt.Errorf("redblacktree: invalid cursor offset in %q", token)
+	}
+	if string(fields[1]) == "null" {
+		return cursor, nil
+	}
+	keyType := tree.keyType()
+	if keyType == nil {
+		return Cursor{}, ErrNoKeyType
+	}
+	key := reflect.New(keyType)
+	if err := json.Unmarshal(fields[1], key.Interface()); err != nil {
+		return Cursor{}, fmt.Errorf("redblacktree: invalid cursor key in %q: %v", token, err)
+	}
+	cursor.Key = key.Elem().Interface()
+	return cursor, nil
+}
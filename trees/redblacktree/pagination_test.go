@@ -0,0 +1,130 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func TestRedBlackTreePage(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{1, 2, 2, 2, 2, 3, 4, 4} {
+		tree.Put(key)
+	}
+
+	var pages []string
+	var cursor Cursor
+	for {
+		entries, next := tree.Page(cursor, 3)
+		if len(entries) == 0 {
+			break
+		}
+		pages = append(pages, fmt.Sprintf("%v", entries))
+		cursor = next
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", pages), "[[{1 1} {2 2}] [{2 2} {3 1}] [{4 2}]]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if actualValue, expectedValue := cursor, (Cursor{Key: 4, Offset: 2}); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreePageConcurrentModification(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{1, 2, 2, 2, 3, 5} {
+		tree.Put(key)
+	}
+
+	entries, cursor := tree.Page(Cursor{}, 2)
+	if actualValue, expectedValue := fmt.Sprintf("%v", entries), "[{1 1} {2 1}]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	tree.Remove(1)
+	tree.Put(4)
+	entries, cursor = tree.Page(cursor, 4)
+	if actualValue, expectedValue := fmt.Sprintf("%v", entries), "[{2 2} {3 1} {4 1}]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	// the cursor's key disappears
+	tree.Remove(4)
+	entries, _ = tree.Page(cursor, 4)
+	if actualValue, expectedValue := fmt.Sprintf("%v", entries), "[{5 1}]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	// the cursor's key lost repetitions that were already returned
+	tree.Remove(2)
+	tree.Remove(2)
+	entries, _ = tree.Page(Cursor{Key: 2, Offset: 3}, 4)
+	if actualValue, expectedValue := fmt.Sprintf("%v", entries), "[{3 1} {5 1}]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeCursorString(t *testing.T) {
+	tree := NewWithIntComparator()
+	tree.Put(1)
+
+	tests := []Cursor{
+		{},
+		{Key: 42, Offset: 3},
+		{Key: -7, Offset: 0},
+	}
+	for _, test := range tests {
+		cursor, err := tree.ParseCursor(test.String())
+		if err != nil {
+			t.Errorf("Got error %v", err)
+		}
+		if cursor != test {
+			t.Errorf("Got %v expected %v", cursor, test)
+		}
+	}
+
+	stringTree := NewWithStringComparator()
+	stringTree.Put("a")
+	if cursor, err := stringTree.ParseCursor((Cursor{Key: "b c", Offset: 1}).String()); err != nil || cursor.Key != "b c" {
+		t.Errorf("Got %v, %v expected %v", cursor, err, "b c")
+	}
+
+	for _, token := range []string{"!", "WzFd", "WyJhIiwxXQ", "Wy0xLDFd"} {
+		if _, err := tree.ParseCursor(token); err == nil {
+			t.Errorf("Expected error for %q", token)
+		}
+	}
+
+	// an empty tree recovers the key type from its comparator
+	token := (Cursor{Key: 42, Offset: 1}).String()
+	if cursor, err := NewWithIntComparator().ParseCursor(token); err != nil || cursor.Key != 42 {
+		t.Errorf("Got %v, %v expected %v", cursor, err, 42)
+	}
+	custom := NewWith(func(a, b interface{}) int { return utils.IntComparator(a, b) })
+	if _, err := custom.ParseCursor(token); err != ErrNoKeyType {
+		t.Errorf("Got %v expected %v", err, ErrNoKeyType)
+	}
+	if cursor, err := custom.ParseCursor((Cursor{}).String()); err != nil || cursor != (Cursor{}) {
+		t.Errorf("Got %v, %v expected the zero cursor", cursor, err)
+	}
+	custom.Put(1)
+	if cursor, err := custom.ParseCursor(token); err != nil || cursor.Key != 42 {
+		t.Errorf("Got %v, %v expected %v", cursor, err, 42)
+	}
+
+	floats := NewWithFloat64Comparator()
+	floats.Put(math.Inf(1))
+	_, cursor := floats.Page(Cursor{}, 1)
+	if _, err := cursor.MarshalText(); err == nil {
+		t.Errorf("Expected error for key %v", cursor.Key)
+	}
+	if _, err := floats.ParseCursor(cursor.String()); err == nil {
+		t.Errorf("Expected error for %q", cursor.String())
+	}
+}
@@ -13,6 +13,7 @@ package redblacktree
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/afiodorov/countedredblacktree/trees"
 	"github.com/afiodorov/countedredblacktree/utils"
@@ -32,6 +33,12 @@ const (
 type Tree struct {
 	Root       *Node
 	Comparator utils.Comparator
+
+	modifications  uint64    // incremented on every mutation, see LiveIterator
+	hasher         EntryHash // hashes entries if not nil, see EnableHashing
+	observer       Observer  // notified of operations if not nil, see SetObserver
+	rebalanceDepth int       // levels climbed by the current rebalancing, counted only if observed
+	watchers       []*Watcher
 }
 
 // Node is a single element within the tree
@@ -43,6 +50,8 @@ type Node struct {
 	Parent      *Node
 	NumChildren int
 	NumRepeated int
+
+	hashes *nodeHashes // nil unless hashing is enabled, see EnableHashing
 }
 
 // NumGreater returns number of nodes in the tree that are > than the node
@@ -53,7 +62,7 @@ func (t *Tree) NumGreater(n *Node) (ret int) {
 			ret += currNode.Right.NumChildren + currNode.Right.NumRepeated + 1
 		}
 		firstParentGreater := currNode.Parent
-		for firstParentGreater != nil && t.Comparator(firstParentGreater.Key, currNode.Key) <= 0 {
+		for firstParentGreater != nil && t.compare(firstParentGreater.Key, currNode.Key) <= 0 {
 			firstParentGreater = firstParentGreater.Parent
 		}
 		if firstParentGreater != nil {
@@ -70,38 +79,49 @@ func (n *Node) setParent(p *Node) {
 	n.updateParentCounts()
 }
 
-// setRight sets right node
-func (n *Node) setRight(r *Node) {
+// setRight sets right node and returns the number of counts updated
+func (n *Node) setRight(r *Node) int {
 	if n.Right != nil {
 		n.NumChildren -= (n.Right.NumChildren + n.Right.NumRepeated + 1)
 	}
 	if r != nil {
 		n.NumChildren += (r.NumChildren + r.NumRepeated + 1)
 	}
+	if n.hashes != nil {
+		n.hashes.childHash += r.subtreeHash() - n.Right.subtreeHash()
+	}
 	n.Right = r
-	n.updateParentCounts()
+	return 1 + n.updateParentCounts()
 }
 
-// setLeft sets left node
-func (n *Node) setLeft(l *Node) {
+// setLeft sets left node and returns the number of counts updated
+func (n *Node) setLeft(l *Node) int {
 	if n.Left != nil {
 		n.NumChildren -= (n.Left.NumChildren + n.Left.NumRepeated + 1)
 	}
 	if l != nil {
 		n.NumChildren += (l.NumChildren + l.NumRepeated + 1)
 	}
+	if n.hashes != nil {
+		n.hashes.childHash += l.subtreeHash() - n.Left.subtreeHash()
+	}
 	n.Left = l
-	n.updateParentCounts()
+	return 1 + n.updateParentCounts()
 }
 
-// copy copies from node
-func (n *Node) copy(c *Node) {
+// copy copies from node and returns the number of counts updated
+func (n *Node) copy(c *Node) int {
 	n.Key = c.Key
 	n.NumRepeated = c.NumRepeated
-	n.updateParentCounts()
+	if n.hashes != nil {
+		n.hashes.hash = c.hashes.hash
+	}
+	return n.updateParentCounts()
 }
 
-func (n *Node) updateParentCounts() {
+// updateParentCounts updates the counts of the node's ancestors, stopping at the first one left unchanged,
+// and returns the number of counts updated.
+func (n *Node) updateParentCounts() (steps int) {
 	if n == nil {
 		return
 	}
@@ -115,12 +135,21 @@ func (n *Node) updateParentCounts() {
 			numL = p.Left.NumChildren + p.Left.NumRepeated + 1
 		}
 		newCount := numR + numL
-		if p.NumChildren == newCount {
+		changed := p.NumChildren != newCount
+		if p.hashes != nil {
+			if newHash := p.Left.subtreeHash() + p.Right.subtreeHash(); p.hashes.childHash != newHash {
+				p.hashes.childHash = newHash
+				changed = true
+			}
+		}
+		if !changed {
 			return
 		}
 		p.NumChildren = newCount
 		p = p.Parent
+		steps++
 	}
+	return
 }
 
 // NewWith instantiates a red-black tree with the custom comparator.
@@ -146,25 +175,47 @@ func NewWithStringComparator() *Tree {
 // Put inserts node into the tree.
 // Key should adhere to the comparator's type assertion, otherwise method panics.
 func (tree *Tree) Put(key interface{}) {
+	tree.PutN(key, 1)
+}
+
+// PutN inserts n repetitions of the key into the tree. Does nothing if n is not positive.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (tree *Tree) PutN(key interface{}, n int) {
+	if n <= 0 {
+		return
+	}
+	if debug {
+		defer tree.mustValidate()
+	}
 	var insertedNode *Node
+	var steps int
+	tree.modifications++
 	if tree.Root == nil {
 		// Assert key is of comparator's type for initial tree
-		tree.Comparator(key, key)
-		tree.Root = &Node{Key: key, color: red}
+		tree.compare(key, key)
+		tree.Root = &Node{Key: key, color: red, NumRepeated: n - 1, hashes: tree.newNodeHashes(key, n)}
 		insertedNode = tree.Root
 	} else {
 		node := tree.Root
 		loop := true
 		for loop {
-			compare := tree.Comparator(key, node.Key)
+			compare := tree.compare(key, node.Key)
 			switch {
 			case compare == 0:
-				node.NumRepeated++
-				node.updateParentCounts()
+				node.NumRepeated += n
+				tree.updateHash(node)
+				steps = node.updateParentCounts()
+				if tree.observer != nil {
+					tree.observer.UpdateCounts(steps)
+					tree.observer.Put(key, n)
+				}
+				if tree.watchers != nil {
+					tree.notifyWatchers(key, n)
+				}
 				return
 			case compare < 0:
 				if node.Left == nil {
-					node.setLeft(&Node{Key: key, color: red})
+					steps = node.setLeft(&Node{Key: key, color: red, NumRepeated: n - 1, hashes: tree.newNodeHashes(key, n)})
 					insertedNode = node.Left
 					loop = false
 				} else {
@@ -172,7 +223,7 @@ func (tree *Tree) Put(key interface{}) {
 				}
 			case compare > 0:
 				if node.Right == nil {
-					node.setRight(&Node{Key: key, color: red})
+					steps = node.setRight(&Node{Key: key, color: red, NumRepeated: n - 1, hashes: tree.newNodeHashes(key, n)})
 					insertedNode = node.Right
 					loop = false
 				} else {
@@ -183,6 +234,108 @@ func (tree *Tree) Put(key interface{}) {
 		insertedNode.setParent(node)
 	}
 	tree.insertCase1(insertedNode)
+	if tree.observer != nil {
+		tree.observer.UpdateCounts(steps)
+		tree.observer.Rebalance(tree.rebalanceDepth)
+		tree.rebalanceDepth = 0
+		tree.observer.Put(key, n)
+	}
+	if tree.watchers != nil {
+		tree.notifyWatchers(key, n)
+	}
+}
+
+// buildSorted replaces the tree's content with n entries supplied in-order by next,
+// building a balanced tree in O(n) without rebalancing.
+// Entries must be sorted by key without duplicates and have positive counts,
+// otherwise an error is returned and the tree is left unchanged.
+func (tree *Tree) buildSorted(n int, next func() (Entry, error)) error {
+	// all levels but the deepest are full, nodes there are red unless it is full too
+	maxDepth := 0
+	for m := n; m > 1; m >>= 1 {
+		maxDepth++
+	}
+	redDepth := -1
+	if n&(n+1) != 0 {
+		redDepth = maxDepth
+	}
+	var prev *Node
+	index := 0
+	var build func(n, depth int) (*Node, error)
+	build = func(n, depth int) (*Node, error) {
+		if n == 0 {
+			return nil, nil
+		}
+		left, err := build((n-1)/2, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if entry.Count <= 0 {
+			return nil, fmt.Errorf("redblacktree: entry %d: count of key %v must be positive, got %d", index, entry.Key, entry.Count)
+		}
+		if prev != nil {
+			switch compare := tree.compare(prev.Key, entry.Key); {
+			case compare == 0:
+				return nil, fmt.Errorf("redblacktree: entry %d: duplicate key %v", index, entry.Key)
+			case compare > 0:
+				return nil, fmt.Errorf("redblacktree: entry %d: key %v is not sorted after %v", index, entry.Key, prev.Key)
+			}
+		}
+		node := &Node{Key: entry.Key, color: black, Left: left, NumRepeated: entry.Count - 1, hashes: tree.newNodeHashes(entry.Key, entry.Count)}
+		if depth == redDepth {
+			node.color = red
+		}
+		prev = node
+		index++
+		node.Right, err = build(n-1-(n-1)/2, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		node.NumChildren = node.Left.size() + node.Right.size()
+		if node.hashes != nil {
+			node.hashes.childHash = node.Left.subtreeHash() + node.Right.subtreeHash()
+		}
+		if node.Left != nil {
+			node.Left.Parent = node
+		}
+		if node.Right != nil {
+			node.Right.Parent = node
+		}
+		return node, nil
+	}
+	root, err := build(n, 0)
+	if err != nil {
+		return err
+	}
+	tree.Root = root
+	tree.modifications++
+	if tree.watchers != nil {
+		tree.rewatchAll()
+	}
+	if debug {
+		tree.mustValidate()
+	}
+	return nil
+}
+
+// replaceWith replaces the tree's content and comparator with those of newTree, which must not be used afterwards.
+func (tree *Tree) replaceWith(newTree *Tree) {
+	tree.Comparator = newTree.Comparator
+	tree.Root = newTree.Root
+	tree.modifications++
+	if tree.hasher != nil {
+		tree.rehash(tree.Root)
+	}
+	if tree.watchers != nil {
+		tree.rewatchAll()
+	}
+	if debug {
+		tree.mustValidate()
+	}
 }
 
 // Get searches the node in the tree by key and returns its value or nil if key is not found in tree.
@@ -200,37 +353,68 @@ func (tree *Tree) Get(key interface{}) bool {
 // Returns false if nothing was removed
 // Key should adhere to the comparator's type assertion, otherwise method panics.
 func (tree *Tree) Remove(key interface{}) bool {
-	var child *Node
+	return tree.RemoveN(key, 1) == 1
+}
+
+// RemoveN removes up to n repetitions of the key from the tree and returns the number of repetitions removed.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (tree *Tree) RemoveN(key interface{}, n int) int {
+	if n <= 0 {
+		return 0
+	}
 	node := tree.lookup(key)
 	if node == nil {
-		return false
+		return 0
 	}
-	if node.NumRepeated > 0 {
-		node.NumRepeated--
-		node.updateParentCounts()
-		return true
+	if debug {
+		defer tree.mustValidate()
+	}
+	tree.modifications++
+	var steps int
+	if n <= node.NumRepeated {
+		node.NumRepeated -= n
+		tree.updateHash(node)
+		steps = node.updateParentCounts()
+	} else {
+		n = node.NumRepeated + 1
+		steps = tree.deleteNode(node)
 	}
+	if tree.observer != nil {
+		tree.observer.UpdateCounts(steps)
+		if tree.rebalanceDepth > 0 {
+			tree.observer.Rebalance(tree.rebalanceDepth)
+			tree.rebalanceDepth = 0
+		}
+		tree.observer.Remove(key, n)
+	}
+	if tree.watchers != nil {
+		tree.notifyWatchers(key, -n)
+	}
+	return n
+}
+
+// deleteNode removes the node with all its repetitions from the tree and returns the number of counts updated.
+func (tree *Tree) deleteNode(node *Node) (steps int) {
+	var child *Node
 	if node.Left != nil && node.Right != nil {
 		pred := node.Left.maximumNode()
-		node.copy(pred)
+		steps += node.copy(pred)
 		node = pred
 	}
-	if node.Left == nil || node.Right == nil {
-		if node.Right == nil {
-			child = node.Left
-		} else {
-			child = node.Right
-		}
-		if node.color == black {
-			node.color = nodeColor(child)
-			tree.deleteCase1(node)
-		}
-		tree.replaceNode(node, child)
-		if node.Parent == nil && child != nil {
-			child.color = black
-		}
+	if node.Right == nil {
+		child = node.Left
+	} else {
+		child = node.Right
+	}
+	if node.color == black {
+		node.color = nodeColor(child)
+		tree.deleteCase1(node)
+	}
+	steps += tree.replaceNode(node, child)
+	if node.Parent == nil && child != nil {
+		child.color = black
 	}
-	return true
+	return steps
 }
 
 // Empty returns true if tree does not contain any nodes
@@ -292,7 +476,7 @@ func (tree *Tree) Floor(key interface{}) (floor *Node, found bool) {
 	found = false
 	node := tree.Root
 	for node != nil {
-		compare := tree.Comparator(key, node.Key)
+		compare := tree.compare(key, node.Key)
 		switch {
 		case compare == 0:
 			return node, true
@@ -321,7 +505,7 @@ func (tree *Tree) Ceiling(key interface{}) (ceiling *Node, found bool) {
 	found = false
 	node := tree.Root
 	for node != nil {
-		compare := tree.Comparator(key, node.Key)
+		compare := tree.compare(key, node.Key)
 		switch {
 		case compare == 0:
 			return node, true
@@ -341,6 +525,10 @@ func (tree *Tree) Ceiling(key interface{}) (ceiling *Node, found bool) {
 // Clear removes all nodes from the tree.
 func (tree *Tree) Clear() {
 	tree.Root = nil
+	tree.modifications++
+	if tree.watchers != nil {
+		tree.rewatchAll()
+	}
 }
 
 // CountGreaterOrEqual returns number of nodes that are >= than supplied key
@@ -349,7 +537,7 @@ func (tree *Tree) CountGreaterOrEqual(key interface{}) (ret int) {
 	node := tree.Root
 ceil:
 	for node != nil {
-		compare := tree.Comparator(key, node.Key)
+		compare := tree.compare(key, node.Key)
 		switch {
 		case compare == 0:
 			ceiling = node
@@ -381,7 +569,7 @@ func (tree *Tree) CountGreater(key interface{}) (ret int) {
 	node := tree.Root
 ceil:
 	for node != nil {
-		compare := tree.Comparator(key, node.Key)
+		compare := tree.compare(key, node.Key)
 		switch {
 		case compare == 0:
 			ceiling = node
@@ -412,7 +600,7 @@ func (tree *Tree) CountSmallerOrEqual(key interface{}) (ret int) {
 	node := tree.Root
 floor:
 	for node != nil {
-		compare := tree.Comparator(key, node.Key)
+		compare := tree.compare(key, node.Key)
 		switch {
 		case compare == 0:
 			floor = node
@@ -444,7 +632,7 @@ func (tree *Tree) CountSmaller(key interface{}) (ret int) {
 	node := tree.Root
 floor:
 	for node != nil {
-		compare := tree.Comparator(key, node.Key)
+		compare := tree.compare(key, node.Key)
 		switch {
 		case compare == 0:
 			floor = node
@@ -469,20 +657,59 @@ floor:
 	return
 }
 
+// EqualRange returns the half-open interval [first, last) of in-order positions occupied by the key,
+// i.e. first is the number of elements smaller than the key and last-first is the number of times it is repeated.
+// If the key is not present first == last is the position it would be inserted at.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (tree *Tree) EqualRange(key interface{}) (first, last int) {
+	node := tree.Root
+	for node != nil {
+		compare := tree.compare(key, node.Key)
+		switch {
+		case compare == 0:
+			if node.Left != nil {
+				first += node.Left.NumChildren + node.Left.NumRepeated + 1
+			}
+			return first, first + node.NumRepeated + 1
+		case compare < 0:
+			node = node.Left
+		case compare > 0:
+			first += node.NumRepeated + 1
+			if node.Left != nil {
+				first += node.Left.NumChildren + node.Left.NumRepeated + 1
+			}
+			node = node.Right
+		}
+	}
+	return first, first
+}
+
 // String returns a string representation of container
 func (tree *Tree) String() string {
-	str := "RedBlackTree\n"
+	var b strings.Builder
+	b.WriteString("RedBlackTree\n")
 	if !tree.Empty() {
-		output(tree.Root, "", true, &str)
+		output(tree.Root, "", true, &b, (*Node).String, -1)
 	}
-	return str
+	return b.String()
 }
 
 func (node *Node) String() string {
 	return fmt.Sprintf("%v", node.Key)
 }
 
-func output(node *Node, prefix string, isTail bool, str *string) {
+// output writes the subtree rooted at node with each node labeled by label,
+// eliding nodes deeper than depth unless it is negative.
+func output(node *Node, prefix string, isTail bool, b *strings.Builder, label func(*Node) string, depth int) {
+	if depth == 0 {
+		b.WriteString(prefix)
+		if isTail {
+			b.WriteString("└── …\n")
+		} else {
+			b.WriteString("┌── …\n")
+		}
+		return
+	}
 	if node.Right != nil {
 		newPrefix := prefix
 		if isTail {
@@ -490,15 +717,16 @@ func output(node *Node, prefix string, isTail bool, str *string) {
 		} else {
 			newPrefix += "    "
 		}
-		output(node.Right, newPrefix, false, str)
+		output(node.Right, newPrefix, false, b, label, depth-1)
 	}
-	*str += prefix
+	b.WriteString(prefix)
 	if isTail {
-		*str += "└── "
+		b.WriteString("└── ")
 	} else {
-		*str += "┌── "
+		b.WriteString("┌── ")
 	}
-	*str += node.String() + "\n"
+	b.WriteString(label(node))
+	b.WriteString("\n")
 	if node.Left != nil {
 		newPrefix := prefix
 		if isTail {
@@ -506,14 +734,50 @@ func output(node *Node, prefix string, isTail bool, str *string) {
 		} else {
 			newPrefix += "│   "
 		}
-		output(node.Left, newPrefix, true, str)
+		output(node.Left, newPrefix, true, b, label, depth-1)
+	}
+}
+
+// higher returns the smallest node strictly larger than the key or nil if there is none.
+func (tree *Tree) higher(key interface{}) (higher *Node) {
+	node := tree.Root
+	for node != nil {
+		if tree.compare(key, node.Key) < 0 {
+			higher = node
+			node = node.Left
+		} else {
+			node = node.Right
+		}
 	}
+	return higher
+}
+
+// lower returns the largest node strictly smaller than the key or nil if there is none.
+func (tree *Tree) lower(key interface{}) (lower *Node) {
+	node := tree.Root
+	for node != nil {
+		if tree.compare(key, node.Key) > 0 {
+			lower = node
+			node = node.Right
+		} else {
+			node = node.Left
+		}
+	}
+	return lower
+}
+
+// compare compares the keys with the tree's comparator.
+func (tree *Tree) compare(a, b interface{}) int {
+	if tree.observer != nil {
+		tree.observer.Compare(a, b)
+	}
+	return tree.Comparator(a, b)
 }
 
 func (tree *Tree) lookup(key interface{}) *Node {
 	node := tree.Root
 	for node != nil {
-		compare := tree.Comparator(key, node.Key)
+		compare := tree.compare(key, node.Key)
 		switch {
 		case compare == 0:
 			return node
@@ -551,6 +815,9 @@ func (node *Node) sibling() *Node {
 }
 
 func (tree *Tree) rotateLeft(node *Node) {
+	if tree.observer != nil {
+		tree.observer.Rotate(node, true)
+	}
 	right := node.Right
 	tree.replaceNode(node, right)
 	node.setRight(right.Left)
@@ -562,6 +829,9 @@ func (tree *Tree) rotateLeft(node *Node) {
 }
 
 func (tree *Tree) rotateRight(node *Node) {
+	if tree.observer != nil {
+		tree.observer.Rotate(node, false)
+	}
 	left := node.Left
 	tree.replaceNode(node, left)
 	node.setLeft(left.Right)
@@ -572,22 +842,27 @@ func (tree *Tree) rotateRight(node *Node) {
 	node.setParent(left)
 }
 
-func (tree *Tree) replaceNode(old *Node, new *Node) {
+// replaceNode puts new in the place of old and returns the number of counts updated.
+func (tree *Tree) replaceNode(old *Node, new *Node) (steps int) {
 	if old.Parent == nil {
 		tree.Root = new
 	} else {
 		if old == old.Parent.Left {
-			old.Parent.setLeft(new)
+			steps = old.Parent.setLeft(new)
 		} else {
-			old.Parent.setRight(new)
+			steps = old.Parent.setRight(new)
 		}
 	}
 	if new != nil {
 		new.setParent(old.Parent)
 	}
+	return steps
 }
 
 func (tree *Tree) insertCase1(node *Node) {
+	if tree.observer != nil {
+		tree.rebalanceDepth++
+	}
 	if node.Parent == nil {
 		node.color = black
 	} else {
@@ -647,7 +922,82 @@ func (node *Node) maximumNode() *Node {
 	return node
 }
 
+func (node *Node) minimumNode() *Node {
+	if node == nil {
+		return nil
+	}
+	for node.Left != nil {
+		node = node.Left
+	}
+	return node
+}
+
+// size returns the number of elements in the subtree rooted at the node.
+func (node *Node) size() int {
+	if node == nil {
+		return 0
+	}
+	return node.NumChildren + node.NumRepeated + 1
+}
+
+// rank returns the number of elements in the tree that are smaller than the node.
+func (node *Node) rank() int {
+	ret := node.Left.size()
+	for ; node.Parent != nil; node = node.Parent {
+		if node == node.Parent.Right {
+			ret += node.Parent.Left.size() + node.Parent.NumRepeated + 1
+		}
+	}
+	return ret
+}
+
+// selectNode returns the node holding the element at the in-order position index (counting repetitions)
+// and the position of the node's first repetition, or nil if index is out of range.
+func (tree *Tree) selectNode(index int) (*Node, int) {
+	first := 0
+	node := tree.Root
+	for node != nil {
+		left := node.Left.size()
+		switch {
+		case index < left:
+			node = node.Left
+		case index <= left+node.NumRepeated:
+			return node, first + left
+		default:
+			first += left + node.NumRepeated + 1
+			index -= left + node.NumRepeated + 1
+			node = node.Right
+		}
+	}
+	return nil, 0
+}
+
+// successor returns the in-order successor of the node or nil if node is the maximum.
+func (node *Node) successor() *Node {
+	if node.Right != nil {
+		return node.Right.minimumNode()
+	}
+	for node.Parent != nil && node == node.Parent.Right {
+		node = node.Parent
+	}
+	return node.Parent
+}
+
+// predecessor returns the in-order predecessor of the node or nil if node is the minimum.
+func (node *Node) predecessor() *Node {
+	if node.Left != nil {
+		return node.Left.maximumNode()
+	}
+	for node.Parent != nil && node == node.Parent.Left {
+		node = node.Parent
+	}
+	return node.Parent
+}
+
 func (tree *Tree) deleteCase1(node *Node) {
+	if tree.observer != nil {
+		tree.rebalanceDepth++
+	}
 	if node.Parent == nil {
 		return
 	}
@@ -110,6 +110,49 @@ func TestRedBlackTreeRemove(t *testing.T) {
 
 }
 
+func TestRedBlackTreePutN(t *testing.T) {
+	tree := NewWithIntComparator()
+	tree.PutN(2, 3)
+	tree.PutN(1, 2)
+	tree.PutN(3, 0)
+	tree.PutN(2, 1)
+	tree.Put(3)
+
+	if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[1 1 2 2 2 2 3]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if actualValue, expectedValue := tree.CountSmaller(3), 6; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeRemoveN(t *testing.T) {
+	tree := NewWithIntComparator()
+	for i := 0; i < 10; i++ {
+		tree.PutN(i, 3)
+	}
+	tests := []struct {
+		key, n, removed int
+	}{
+		{5, 2, 2},
+		{5, 0, 0},
+		{5, 2, 1},
+		{5, 1, 0},
+		{3, 3, 3},
+		{7, 10, 3},
+		{42, 1, 0},
+	}
+	for _, test := range tests {
+		if actualValue := tree.RemoveN(test.key, test.n); actualValue != test.removed {
+			t.Errorf("RemoveN(%v, %v): Got %v expected %v", test.key, test.n, actualValue, test.removed)
+		}
+	}
+	assertValidTree(t, tree)
+	if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[0 0 0 1 1 1 2 2 2 4 4 4 6 6 6 8 8 8 9 9 9]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
 func TestRedBlackTreeLeftAndRight(t *testing.T) {
 	tree := NewWithIntComparator()
 
@@ -508,6 +551,137 @@ func TestRedBlackTreeIteratorLast(t *testing.T) {
 	}
 }
 
+func TestRedBlackTreeIteratorAt(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{10, 20, 30, 20, 40} {
+		tree.Put(key)
+	}
+
+	tests := [][]interface{}{
+		{5, 10},
+		{10, 10},
+		{15, 20},
+		{40, 40},
+	}
+	for _, test := range tests {
+		it := tree.IteratorAt(test[0])
+		if actualValue, expectedValue := it.Key(), test[1]; actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+
+	it := tree.IteratorAt(25)
+	if actualValue, expectedValue := fmt.Sprintf("%v %v", it.Key(), it.Count()), "30 1"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if !it.Prev() || it.Key() != 20 || it.Count() != 2 {
+		t.Errorf("Got %v expected %v", it.Key(), 20)
+	}
+
+	it = tree.IteratorAt(45)
+	if it.Next() {
+		t.Errorf("Got %v expected end", it.Key())
+	}
+	it = tree.IteratorAt(45)
+	if !it.Prev() || it.Key() != 40 {
+		t.Errorf("Got %v expected %v", it.Key(), 40)
+	}
+}
+
+func TestRedBlackTreeIteratorSeekFloor(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{10, 20, 30} {
+		tree.Put(key)
+	}
+	it := tree.Iterator()
+	if !it.SeekFloor(25) || it.Key() != 20 {
+		t.Errorf("Got %v expected %v", it.Key(), 20)
+	}
+	if !it.Next() || it.Key() != 30 {
+		t.Errorf("Got %v expected %v", it.Key(), 30)
+	}
+	if it.SeekFloor(5) {
+		t.Errorf("Got %v expected begin", it.Key())
+	}
+	if !it.Next() || it.Key() != 10 {
+		t.Errorf("Got %v expected %v", it.Key(), 10)
+	}
+}
+
+func TestRedBlackTreeRangeIterator(t *testing.T) {
+	tree := NewWithIntComparator()
+	for i := 0; i < 10; i++ {
+		tree.Put(i)
+	}
+
+	tests := [][]interface{}{
+		{3, 6, "[3 4 5 6]"},
+		{nil, 2, "[0 1 2]"},
+		{7, nil, "[7 8 9]"},
+		{nil, nil, "[0 1 2 3 4 5 6 7 8 9]"},
+		{-5, -1, "[]"},
+		{6, 3, "[]"},
+	}
+	for _, test := range tests {
+		it := tree.RangeIterator(test[0], test[1])
+		keys := []interface{}{}
+		for it.Next() {
+			keys = append(keys, it.Key())
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", keys), test[2]; actualValue != expectedValue {
+			t.Errorf("Next: Got %v expected %v", actualValue, expectedValue)
+		}
+		keys = []interface{}{}
+		for it.Prev() {
+			keys = append([]interface{}{it.Key()}, keys...)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", keys), test[2]; actualValue != expectedValue {
+			t.Errorf("Prev: Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+
+	it := tree.RangeIterator(3, 6)
+	if !it.Seek(0) || it.Key() != 3 {
+		t.Errorf("Got %v expected %v", it.Key(), 3)
+	}
+	if !it.Seek(5) || it.Key() != 5 {
+		t.Errorf("Got %v expected %v", it.Key(), 5)
+	}
+	if it.Seek(7) {
+		t.Errorf("Got %v expected end", it.Key())
+	}
+	if !it.SeekFloor(9) || it.Key() != 6 {
+		t.Errorf("Got %v expected %v", it.Key(), 6)
+	}
+	if it.SeekFloor(2) {
+		t.Errorf("Got %v expected begin", it.Key())
+	}
+}
+
+func TestRedBlackTreeEqualRange(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{1, 3, 3, 3, 5, 7, 7} {
+		tree.Put(key)
+	}
+
+	// key, first, last
+	tests := [][]interface{}{
+		{0, 0, 0},
+		{1, 0, 1},
+		{2, 1, 1},
+		{3, 1, 4},
+		{5, 4, 5},
+		{7, 5, 7},
+		{8, 7, 7},
+	}
+	for _, test := range tests {
+		first, last := tree.EqualRange(test[0])
+		if first != test[1] || last != test[2] {
+			t.Errorf("EqualRange(%v): Got [%v, %v) expected [%v, %v)", test[0], first, last, test[1], test[2])
+		}
+	}
+}
+
 func TestRedBlackTreeSerialization(t *testing.T) {
 	tree := NewWithStringComparator()
 	tree.Put("c")
@@ -640,6 +814,9 @@ func TestRedBlackTreeNumGreater(t *testing.T) {
 
 		it := tree.Iterator()
 		it.Begin()
+		if actualValue, expectedValue := it.NumGreater(), 0; actualValue != expectedValue {
+			t.Errorf("NumGreater at begin: Got %v expected %v", actualValue, expectedValue)
+		}
 		for i := 0; it.Next(); {
 			for j := 0; j < it.Count(); i, j = i+1, j+1 {
 				if expected, actual := array[i], it.Key().(int); expected != actual {
@@ -650,6 +827,108 @@ func TestRedBlackTreeNumGreater(t *testing.T) {
 				}
 			}
 		}
+		if actualValue, expectedValue := it.NumGreater(), 0; actualValue != expectedValue {
+			t.Errorf("NumGreater at end: Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+}
+
+func TestRedBlackTreeIteratorRank(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	tree := NewWithIntComparator()
+	array := make([]int, 200)
+	for j := range array {
+		array[j] = r.Intn(50)
+		tree.Put(array[j])
+	}
+	sort.Ints(array)
+
+	it := tree.Iterator()
+	if actualValue, expectedValue := it.Index(), -1; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	for it.Next() {
+		if expected, actual := sort.SearchInts(array, it.Key().(int)), it.Rank(); expected != actual {
+			t.Errorf("Rank: Got %v expected %v", actual, expected)
+		}
+		if expected, actual := it.Rank(), it.NumSmaller(); expected != actual {
+			t.Errorf("NumSmaller: Got %v expected %v", actual, expected)
+		}
+	}
+	if actualValue, expectedValue := it.Index(), len(array); actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	for it.Prev() {
+		if expected, actual := sort.SearchInts(array, it.Key().(int)), it.Index(); expected != actual {
+			t.Errorf("Index: Got %v expected %v", actual, expected)
+		}
+	}
+
+	for i := range array {
+		if !it.SeekRank(i) {
+			t.Errorf("SeekRank(%v): expected element", i)
+		}
+		if expected, actual := array[i], it.Key(); expected != actual {
+			t.Errorf("SeekRank: Got %v expected %v", actual, expected)
+		}
+		if expected, actual := sort.SearchInts(array, array[i]), it.NumSmaller(); expected != actual {
+			t.Errorf("NumSmaller: Got %v expected %v", actual, expected)
+		}
+		if expected, actual := len(array)-sort.SearchInts(array, array[i]+1), it.NumGreater(); expected != actual {
+			t.Errorf("NumGreater: Got %v expected %v", actual, expected)
+		}
+	}
+}
+
+func TestRedBlackTreeIteratorSkip(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{1, 1, 1, 2, 3, 3, 4} {
+		tree.Put(key)
+	}
+	it := tree.Iterator()
+
+	// skip, expected index, expected key
+	tests := [][]interface{}{
+		{1, 0, 1},
+		{2, 2, 1},
+		{1, 3, 2},
+		{2, 5, 3},
+		{-4, 1, 1},
+		{6, 7, nil},
+		{-1, 6, 4},
+		{-7, -1, nil},
+	}
+	for _, test := range tests {
+		found := it.Skip(test[0].(int))
+		if actualValue, expectedValue := it.Index(), test[1]; actualValue != expectedValue {
+			t.Errorf("Skip(%v): Got %v expected %v", test[0], actualValue, expectedValue)
+		}
+		if found != (test[2] != nil) || found && it.Key() != test[2] {
+			t.Errorf("Skip(%v): Got %v expected %v", test[0], found, test[2])
+		}
+	}
+
+	it.SeekRank(1)
+	if !it.Next() || it.Key() != 2 || it.Index() != 3 {
+		t.Errorf("Got %v expected %v", it.Key(), 2)
+	}
+	it.SeekRank(5)
+	if !it.Prev() || it.Key() != 2 || it.Index() != 3 {
+		t.Errorf("Got %v expected %v", it.Key(), 2)
+	}
+
+	it = tree.RangeIterator(2, 3)
+	if actualValue, expectedValue := it.Index(), 2; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	if !it.Skip(2) || it.Key() != 3 {
+		t.Errorf("Got %v expected %v", it.Key(), 3)
+	}
+	if it.Skip(2) || it.Index() != 6 {
+		t.Errorf("Got %v expected %v", it.Index(), 6)
+	}
+	if it.Skip(-5) || it.Index() != 2 {
+		t.Errorf("Got %v expected %v", it.Index(), 2)
 	}
 }
 
@@ -0,0 +1,260 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// defaultMaxLog is the default number of mutations a primary retains for resuming replicas.
+const defaultMaxLog = 4096
+
+// PrimaryOptions configures a Primary.
+type PrimaryOptions struct {
+	// MaxLog is the number of recent mutations retained for replicas to resume from, 4096 if zero.
+	// Replicas lagging further behind receive a new snapshot when they reconnect.
+	MaxLog int
+	// OnAck, if not nil, is called with the replica's name and sequence number of every acknowledgement.
+	// It is called from the goroutine serving the replica.
+	OnAck func(replica string, sequence uint64)
+}
+
+// Primary owns the replicated tree: mutations must go through it to be streamed to replicas.
+// Its methods are safe for concurrent use.
+type Primary struct {
+	mu       sync.Mutex
+	changed  *sync.Cond
+	tree     *redblacktree.Tree
+	keyType  utils.KeyType
+	options  PrimaryOptions
+	id       uint64
+	sequence uint64     // sequence number of the last mutation
+	log      []mutation // retained mutations, the last one numbered sequence
+	closed   bool
+}
+
+// NewPrimary returns a primary replicating the tree.
+// The tree's comparator must be registered with utils.RegisterKeyType.
+func NewPrimary(tree *redblacktree.Tree, options PrimaryOptions) (*Primary, error) {
+	keyType, found := utils.KeyTypeOf(tree.Comparator)
+	if !found {
+		return nil, redblacktree.ErrNoKeyType
+	}
+	if options.MaxLog <= 0 {
+		options.MaxLog = defaultMaxLog
+	}
+	var id [8]byte
+	for binary.LittleEndian.Uint64(id[:]) == 0 {
+		if _, err := rand.Read(id[:]); err != nil {
+			return nil, err
+		}
+	}
+	primary := &Primary{tree: tree, keyType: keyType, options: options, id: binary.LittleEndian.Uint64(id[:])}
+	primary.changed = sync.NewCond(&primary.mu)
+	return primary, nil
+}
+
+// View calls f with the tree, which must not be mutated, excluding concurrent mutations.
+func (primary *Primary) View(f func(tree *redblacktree.Tree)) {
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+	f(primary.tree)
+}
+
+// Sequence returns the sequence number of the last mutation.
+func (primary *Primary) Sequence() uint64 {
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+	return primary.sequence
+}
+
+// Put inserts key into the tree and returns its sequence number.
+func (primary *Primary) Put(key interface{}) (uint64, error) {
+	return primary.PutN(key, 1)
+}
+
+// PutN inserts n occurrences of key into the tree and returns its sequence number.
+// It does nothing and returns the current sequence number if n is not positive.
+func (primary *Primary) PutN(key interface{}, n int) (uint64, error) {
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+	if n <= 0 {
+		return primary.sequence, nil
+	}
+	if err := primary.append(opPut, key, uint64(n)); err != nil {
+		return 0, err
+	}
+	primary.tree.PutN(key, n)
+	return primary.sequence, nil
+}
+
+// Remove removes one occurrence of key from the tree, reporting whether key was found,
+// and returns its sequence number. Removing a missing key is not replicated.
+func (primary *Primary) Remove(key interface{}) (bool, uint64, error) {
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+	if !primary.tree.Get(key) {
+		return false, primary.sequence, nil
+	}
+	if err := primary.append(opRemove, key, 0); err != nil {
+		return false, 0, err
+	}
+	return primary.tree.Remove(key), primary.sequence, nil
+}
+
+// Clear removes all keys from the tree and returns its sequence number.
+func (primary *Primary) Clear() (uint64, error) {
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+	if err := primary.append(opClear, nil, 0); err != nil {
+		return 0, err
+	}
+	primary.tree.Clear()
+	return primary.sequence, nil
+}
+
+// Close disconnects all replicas: every Serve closes its connection and returns, and mutations fail with ErrClosed.
+func (primary *Primary) Close() {
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+	primary.closed = true
+	primary.changed.Broadcast()
+}
+
+// append numbers and retains a mutation and wakes up the replicas, the caller holds the lock.
+func (primary *Primary) append(op byte, key interface{}, n uint64) error {
+	if primary.closed {
+		return ErrClosed
+	}
+	m := mutation{sequence: primary.sequence + 1, op: op, n: n}
+	if op != opClear {
+		var err error
+		if m.key, err = primary.keyType.Codec.Encode(key); err != nil {
+			return err
+		}
+	}
+	if len(primary.log) >= primary.options.MaxLog {
+		// drop the older half, so retaining costs amortized O(1) per mutation
+		primary.log = append(primary.log[:0], primary.log[len(primary.log)-primary.options.MaxLog/2:]...)
+	}
+	primary.log = append(primary.log, m)
+	primary.sequence = m.sequence
+	primary.changed.Broadcast()
+	return nil
+}
+
+// Serve replicates the tree to the replica connected by conn until the connection fails or the primary is closed,
+// then closes conn and returns, nil if the primary was closed.
+func (primary *Primary) Serve(conn io.ReadWriteCloser) error {
+	defer conn.Close()
+	r, w := newReader(conn), newWriter(conn)
+	if string(r.Read(len(magic))) != magic || r.Read(1)[0] != version {
+		if r.Err != nil {
+			return r.Err
+		}
+		return fmt.Errorf("%w: invalid hello", ErrProtocol)
+	}
+	replicaPrimary := r.ReadUint64()
+	sequence := r.ReadUvarint()
+	name := string(r.ReadBytes())
+	if r.Err != nil {
+		return r.Err
+	}
+
+	w.Write([]byte(magic))
+	w.Write([]byte{version})
+	w.WriteUint64(primary.id)
+	w.WriteBytes([]byte(primary.keyType.Name))
+	primary.mu.Lock()
+	if replicaPrimary == primary.id && primary.retains(sequence) {
+		primary.mu.Unlock()
+		w.Write([]byte{modeResume})
+	} else {
+		sequence = primary.sequence
+		data, err := primary.tree.MarshalBinary()
+		primary.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		w.Write([]byte{modeSnapshot})
+		w.WriteUvarint(sequence)
+		w.WriteBytes(data)
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	acks, stopped := make(chan error, 1), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		acks <- primary.readAcks(r, name)
+		primary.mu.Lock()
+		primary.changed.Broadcast()
+		primary.mu.Unlock()
+	}()
+	err := primary.stream(w, sequence, name, acks)
+	// closing conn ends readAcks
+	conn.Close()
+	<-stopped
+	return err
+}
+
+// stream writes the mutations after sequence as they happen until writing fails,
+// reading acknowledgements fails or the primary is closed.
+func (primary *Primary) stream(w *writer, sequence uint64, name string, acks <-chan error) error {
+	var batch []mutation
+	for {
+		primary.mu.Lock()
+		for sequence == primary.sequence && !primary.closed && len(acks) == 0 {
+			primary.changed.Wait()
+		}
+		if primary.closed {
+			primary.mu.Unlock()
+			return nil
+		}
+		if len(acks) != 0 {
+			primary.mu.Unlock()
+			return <-acks
+		}
+		if !primary.retains(sequence) {
+			primary.mu.Unlock()
+			return fmt.Errorf("replication: replica %q lags behind the retained log at sequence %d", name, sequence)
+		}
+		batch = append(batch[:0], primary.log[len(primary.log)-int(primary.sequence-sequence):]...)
+		primary.mu.Unlock()
+		for _, m := range batch {
+			w.writeMutation(m)
+		}
+		if err := w.flush(); err != nil {
+			return err
+		}
+		sequence = batch[len(batch)-1].sequence
+	}
+}
+
+// retains returns whether the mutations after sequence are retained, the caller holds the lock.
+func (primary *Primary) retains(sequence uint64) bool {
+	return sequence <= primary.sequence && primary.sequence-sequence <= uint64(len(primary.log))
+}
+
+// readAcks reads acknowledgements until the connection fails.
+func (primary *Primary) readAcks(r *reader, name string) error {
+	for {
+		sequence := r.ReadUvarint()
+		if r.Err != nil {
+			return r.Err
+		}
+		if primary.options.OnAck != nil {
+			primary.options.OnAck(name, sequence)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replication
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// Replica applies the mutations of a Primary to its own tree.
+// Its methods are safe for concurrent use, but only one Sync may run at a time.
+type Replica struct {
+	mu       sync.RWMutex
+	name     string
+	tree     *redblacktree.Tree
+	primary  uint64 // identifier of the primary the tree is from, zero before the first snapshot
+	sequence uint64 // sequence number of the last applied mutation
+}
+
+// NewReplica returns a replica replacing the content of tree by the primary's.
+// The name is reported to the primary's PrimaryOptions.OnAck.
+// If the tree has no comparator the one registered for the primary's key type is used.
+func NewReplica(name string, tree *redblacktree.Tree) *Replica {
+	return &Replica{name: name, tree: tree}
+}
+
+// View calls f with the tree, which must not be mutated, excluding concurrent updates.
+func (replica *Replica) View(f func(tree *redblacktree.Tree)) {
+	replica.mu.RLock()
+	defer replica.mu.RUnlock()
+	f(replica.tree)
+}
+
+// Sequence returns the sequence number of the last applied mutation.
+func (replica *Replica) Sequence() uint64 {
+	replica.mu.RLock()
+	defer replica.mu.RUnlock()
+	return replica.sequence
+}
+
+// Sync connects to the primary over conn and applies its mutations until the connection fails,
+// returning nil if the primary ended it cleanly. Calling Sync again over a new connection resumes
+// from the last applied mutation. Sync does not close conn.
+func (replica *Replica) Sync(conn io.ReadWriter) error {
+	r, w := newReader(conn), newWriter(conn)
+	replica.mu.RLock()
+	w.Write([]byte(magic))
+	w.Write([]byte{version})
+	w.WriteUint64(replica.primary)
+	w.WriteUvarint(replica.sequence)
+	replica.mu.RUnlock()
+	w.WriteBytes([]byte(replica.name))
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	if string(r.Read(len(magic))) != magic || r.Read(1)[0] != version {
+		if r.Err != nil {
+			return r.Err
+		}
+		return fmt.Errorf("%w: invalid handshake", ErrProtocol)
+	}
+	primary := r.ReadUint64()
+	name := string(r.ReadBytes())
+	mode := r.Read(1)[0]
+	if r.Err != nil {
+		return r.Err
+	}
+	keyType, found := utils.KeyTypeByName(name)
+	if !found {
+		return fmt.Errorf("replication: unknown key type %q", name)
+	}
+	if replica.tree.Comparator != nil {
+		if ownKeyType, _ := utils.KeyTypeOf(replica.tree.Comparator); ownKeyType.Name != name {
+			return fmt.Errorf("replication: primary key type %q does not match comparator", name)
+		}
+	}
+	switch mode {
+	case modeResume:
+		if replica.primary != primary {
+			return fmt.Errorf("%w: resuming from another primary", ErrProtocol)
+		}
+	case modeSnapshot:
+		sequence := r.ReadUvarint()
+		data := r.ReadBytes()
+		if r.Err != nil {
+			return r.Err
+		}
+		replica.mu.Lock()
+		err := replica.tree.UnmarshalBinary(data)
+		if err == nil {
+			replica.primary, replica.sequence = primary, sequence
+		}
+		replica.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown mode %d", ErrProtocol, mode)
+	}
+
+	for {
+		if _, err := r.buf.Peek(1); err == io.EOF {
+			return nil
+		}
+		m := r.readMutation()
+		if r.Err != nil {
+			return r.Err
+		}
+		if err := replica.apply(m, keyType); err != nil {
+			return err
+		}
+		w.WriteUvarint(m.sequence)
+		if r.buf.Buffered() == 0 {
+			// acknowledge a batch once it is applied
+			if err := w.flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// apply applies the next mutation.
+func (replica *Replica) apply(m mutation, keyType utils.KeyType) error {
+	var key interface{}
+	if m.op != opClear {
+		var err error
+		if key, err = keyType.Codec.Decode(m.key); err != nil {
+			return fmt.Errorf("%w: mutation %d: %v", ErrProtocol, m.sequence, err)
+		}
+	}
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+	if m.sequence != replica.sequence+1 {
+		return fmt.Errorf("%w: got mutation %d after %d", ErrProtocol, m.sequence, replica.sequence)
+	}
+	switch m.op {
+	case opPut:
+		if m.n == 0 || m.n > uint64(^uint(0)>>1) {
+			return fmt.Errorf("%w: mutation %d: invalid count %d", ErrProtocol, m.sequence, m.n)
+		}
+		replica.tree.PutN(key, int(m.n))
+	case opRemove:
+		replica.tree.Remove(key)
+	case opClear:
+		replica.tree.Clear()
+	}
+	replica.sequence = m.sequence
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package replication keeps copies of a redblacktree.Tree up to date with the tree of a single writer.
+//
+// A Primary applies mutations to its tree and numbers them with consecutive sequence numbers.
+// A Replica connects to it over any io.ReadWriter, such as a net.Conn, receives a snapshot of the tree
+// followed by the mutations in order, applies them to its own tree and acknowledges their sequence numbers.
+// After a disconnect the replica resumes from the last applied sequence number if the primary still
+// retains the mutations since, otherwise it receives a new snapshot.
+//
+// The trees' comparators must be registered with utils.RegisterKeyType.
+package replication
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree/internal/wire"
+)
+
+// The replica starts a connection with the hello
+//
+//	magic    "CRBTREPL"
+//	version  byte
+//	primary  uint64 little-endian identifier of the primary the replica's state is from, zero without state
+//	sequence uvarint last applied sequence number
+//	name     uvarint length followed by the replica's name
+//
+// The primary answers with
+//
+//	magic    "CRBTREPL"
+//	version  byte
+//	primary  uint64 little-endian identifier of the primary
+//	keyType  uvarint length followed by the name of the key type, see utils.RegisterKeyType
+//	mode     byte, modeResume or modeSnapshot followed by the uvarint sequence number of the snapshot and
+//	         the tree's binary encoding prefixed by its uvarint length, see redblacktree.Tree.MarshalBinary
+//
+// and then streams mutations as uvarint sequence number, operation byte and for opPut uvarint n and key,
+// for opRemove the key. Keys are their codec's encoding prefixed by uvarint length.
+// The replica acknowledges applied mutations with their uvarint sequence number.
+const (
+	magic   = "CRBTREPL"
+	version = 1
+
+	modeResume   byte = 0
+	modeSnapshot byte = 1
+
+	opPut    byte = 1
+	opRemove byte = 2
+	opClear  byte = 3
+)
+
+var (
+	// ErrClosed is returned by the methods of a closed Primary.
+	ErrClosed = errors.New("replication: primary closed")
+	// ErrProtocol is returned when the peer does not follow the replication protocol.
+	ErrProtocol = errors.New("replication: protocol error")
+)
+
+// mutation is a numbered mutation with its key encoded.
+type mutation struct {
+	sequence uint64
+	op       byte
+	n        uint64
+	key      []byte
+}
+
+// writer buffers the fields written until flush.
+type writer struct {
+	*wire.Writer
+	buf *bufio.Writer
+}
+
+func newWriter(w io.Writer) *writer {
+	buf := bufio.NewWriter(w)
+	return &writer{Writer: &wire.Writer{W: buf}, buf: buf}
+}
+
+func (w *writer) writeMutation(m mutation) {
+	w.WriteUvarint(m.sequence)
+	w.Write([]byte{m.op})
+	switch m.op {
+	case opPut:
+		w.WriteUvarint(m.n)
+		w.WriteBytes(m.key)
+	case opRemove:
+		w.WriteBytes(m.key)
+	}
+}
+
+func (w *writer) flush() error {
+	if w.Err == nil {
+		w.Err = w.buf.Flush()
+	}
+	return w.Err
+}
+
+// reader buffers the connection, so that a replica can tell whether more mutations arrived.
+type reader struct {
+	*wire.Reader
+	buf *bufio.Reader
+}
+
+func newReader(r io.Reader) *reader {
+	buf := bufio.NewReader(r)
+	return &reader{Reader: &wire.Reader{R: buf}, buf: buf}
+}
+
+func (r *reader) readMutation() (m mutation) {
+	m.sequence = r.ReadUvarint()
+	m.op = r.Read(1)[0]
+	switch m.op {
+	case opPut:
+		m.n = r.ReadUvarint()
+		m.key = r.ReadBytes()
+	case opRemove:
+		m.key = r.ReadBytes()
+	case opClear:
+	default:
+		if r.Err == nil {
+			r.Err = ErrProtocol
+		}
+	}
+	return m
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree"
+)
+
+// countingConn counts the bytes read from a connection.
+type countingConn struct {
+	net.Conn
+	n int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+type testReplication struct {
+	t       *testing.T
+	primary *Primary
+	replica *Replica
+	acked   uint64
+}
+
+func newTestReplication(t *testing.T, maxLog int) *testReplication {
+	test := &testReplication{t: t}
+	tree := redblacktree.NewWithIntComparator()
+	for i := 0; i < 1000; i++ {
+		tree.PutN(i, i%3+1)
+	}
+	var err error
+	test.primary, err = NewPrimary(tree, PrimaryOptions{MaxLog: maxLog, OnAck: func(replica string, sequence uint64) {
+		if replica != "replica" {
+			t.Errorf("Got %v expected %v", replica, "replica")
+		}
+		atomic.StoreUint64(&test.acked, sequence)
+	}})
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	test.replica = NewReplica("replica", &redblacktree.Tree{})
+	return test
+}
+
+// connect serves the replica over a pipe, returning its replica side and a function disconnecting it.
+func (test *testReplication) connect() (*countingConn, func() (error, error)) {
+	primaryConn, replicaConn := net.Pipe()
+	conn := &countingConn{Conn: replicaConn}
+	served, synced := make(chan error, 1), make(chan error, 1)
+	go func() { served <- test.primary.Serve(primaryConn) }()
+	go func() { synced <- test.replica.Sync(conn) }()
+	return conn, func() (error, error) {
+		primaryConn.Close()
+		err := <-served
+		replicaConn.Close()
+		return err, <-synced
+	}
+}
+
+// wait waits until the replica acknowledged the primary's last mutation and compares the trees.
+func (test *testReplication) wait() {
+	sequence := test.primary.Sequence()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		test.replica.mu.RLock()
+		synced := test.replica.primary == test.primary.id && test.replica.sequence >= sequence
+		test.replica.mu.RUnlock()
+		if synced {
+			break
+		}
+		if time.Now().After(deadline) {
+			test.t.Fatalf("Got sequence %v expected %v", test.replica.Sequence(), sequence)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var expected, actual string
+	test.primary.View(func(tree *redblacktree.Tree) { expected = fmt.Sprintf("%v", tree.Keys()) })
+	test.replica.View(func(tree *redblacktree.Tree) { actual = fmt.Sprintf("%v", tree.Keys()) })
+	if actual != expected {
+		test.t.Errorf("Got %v expected %v", actual, expected)
+	}
+}
+
+// waitAcked waits until the primary received the acknowledgement of its last mutation.
+func (test *testReplication) waitAcked() {
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadUint64(&test.acked) != test.primary.Sequence(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			test.t.Fatalf("Got acknowledged %v expected %v", atomic.LoadUint64(&test.acked), test.primary.Sequence())
+		}
+	}
+}
+
+func TestReplication(t *testing.T) {
+	test := newTestReplication(t, 0)
+	conn, disconnect := test.connect()
+	test.wait()
+	snapshotSize := atomic.LoadInt64(&conn.n)
+	for i := 0; i < 100; i++ {
+		test.primary.PutN(i*7, i%5)
+		test.primary.Remove(i * 3)
+	}
+	test.wait()
+	test.waitAcked()
+	disconnect()
+
+	test.primary.Clear()
+	for i := 0; i < 100; i++ {
+		test.primary.Put(i % 10)
+	}
+	if found, _, _ := test.primary.Remove(5); !found {
+		t.Errorf("Got %v expected %v", found, true)
+	}
+	conn, disconnect = test.connect()
+	test.wait()
+	if resumed := atomic.LoadInt64(&conn.n); resumed >= snapshotSize {
+		t.Errorf("Got %v bytes read on resume expected less than %v", resumed, snapshotSize)
+	}
+
+	test.waitAcked()
+	test.primary.Close()
+	if served, synced := disconnect(); served != nil || synced != nil {
+		t.Errorf("Got %v %v expected nil", served, synced)
+	}
+	if _, err := test.primary.Put(1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got %v expected %v", err, ErrClosed)
+	}
+}
+
+func TestReplicationSnapshotAfterLag(t *testing.T) {
+	test := newTestReplication(t, 8)
+	conn, disconnect := test.connect()
+	test.wait()
+	snapshotSize := atomic.LoadInt64(&conn.n)
+	disconnect()
+
+	for i := 0; i < 100; i++ {
+		test.primary.Put(-i)
+	}
+	conn, disconnect = test.connect()
+	test.wait()
+	if actualValue := atomic.LoadInt64(&conn.n); actualValue < snapshotSize {
+		t.Errorf("Got %v bytes read expected a snapshot of at least %v", actualValue, snapshotSize)
+	}
+	test.primary.Put(1000)
+	test.wait()
+	disconnect()
+
+	// a new primary has different sequence numbers, the replica must start over
+	test.primary.Close()
+	test.primary, _ = NewPrimary(redblacktree.NewWithIntComparator(), PrimaryOptions{})
+	test.primary.Put(42)
+	_, disconnect = test.connect()
+	test.wait()
+	disconnect()
+}
+
+func TestReplicationCloseDisconnects(t *testing.T) {
+	primary, _ := NewPrimary(redblacktree.NewWithIntComparator(), PrimaryOptions{})
+	primary.Put(1)
+	replica := NewReplica("replica", &redblacktree.Tree{})
+	primaryConn, replicaConn := net.Pipe()
+	served, synced := make(chan error, 1), make(chan error, 1)
+	go func() { served <- primary.Serve(primaryConn) }()
+	go func() { synced <- replica.Sync(replicaConn) }()
+	for replica.Sequence() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// neither side closes its connection, the primary does on Close
+	primary.Close()
+	if err := <-served; err != nil {
+		t.Errorf("Got %v expected nil", err)
+	}
+	if err := <-synced; err != nil {
+		t.Errorf("Got %v expected nil", err)
+	}
+}
+
+func TestReplicationInvalid(t *testing.T) {
+	if _, err := NewPrimary(redblacktree.NewWith(func(a, b interface{}) int { return 0 }), PrimaryOptions{}); !errors.Is(err, redblacktree.ErrNoKeyType) {
+		t.Errorf("Got %v expected %v", err, redblacktree.ErrNoKeyType)
+	}
+
+	primary, _ := NewPrimary(redblacktree.NewWithIntComparator(), PrimaryOptions{})
+	replica := NewReplica("replica", redblacktree.NewWithStringComparator())
+	primaryConn, replicaConn := net.Pipe()
+	go primary.Serve(primaryConn)
+	if err := replica.Sync(replicaConn); err == nil {
+		t.Errorf("Got no error for mismatching key types")
+	}
+	primaryConn.Close()
+	replicaConn.Close()
+
+	primaryConn, replicaConn = net.Pipe()
+	go replicaConn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	if err := primary.Serve(primaryConn); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Got %v expected %v", err, ErrProtocol)
+	}
+	primaryConn.Close()
+	replicaConn.Close()
+}
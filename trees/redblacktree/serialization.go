@@ -6,6 +6,9 @@ package redblacktree
 
 import (
 	"encoding/json"
+	"fmt"
+	"reflect"
+
 	"github.com/afiodorov/countedredblacktree/containers"
 	"github.com/afiodorov/countedredblacktree/utils"
 )
@@ -13,29 +16,199 @@ import (
 func assertSerializationImplementation() {
 	var _ containers.JSONSerializer = (*Tree)(nil)
 	var _ containers.JSONDeserializer = (*Tree)(nil)
+	var _ json.Marshaler = (*Tree)(nil)
+	var _ json.Unmarshaler = (*Tree)(nil)
+}
+
+// jsonVersion is the version of the JSON format written by ToJSON.
+const jsonVersion = 1
+
+// jsonTree is the JSON representation of the tree:
+//
+//	{"version":1,"keyType":"int","entries":[[1,3],[2,1]]}
+//
+// Entries are [key, count] pairs in-order. KeyType is the name the tree's comparator is registered
+// under with utils.RegisterKeyType so keys are restored with the same type and comparator,
+// it is empty for unregistered comparators.
+type jsonTree struct {
+	Version int                  `json:"version"`
+	KeyType string               `json:"keyType,omitempty"`
+	Entries [][2]json.RawMessage `json:"entries"`
 }
 
 // ToJSON outputs the JSON representation of the tree.
 func (tree *Tree) ToJSON() ([]byte, error) {
-	elements := make(map[string]int)
-	it := tree.Iterator()
-	for it.Next() {
-		elements[utils.ToString(it.Key())] = it.Count()
-	}
-	return json.Marshal(&elements)
+	return tree.MarshalJSON()
 }
 
 // FromJSON populates the tree from the input JSON representation.
 func (tree *Tree) FromJSON(data []byte) error {
+	return tree.UnmarshalJSON(data)
+}
+
+// MarshalJSON implements json.Marshaler, see ToJSON.
+func (tree *Tree) MarshalJSON() ([]byte, error) {
+	elements := jsonTree{Version: jsonVersion, Entries: make([][2]json.RawMessage, 0)}
+	if keyType, found := utils.KeyTypeOf(tree.Comparator); found {
+		elements.KeyType = keyType.Name
+	}
+	for node := tree.Left(); node != nil; node = node.successor() {
+		key, err := json.Marshal(node.Key)
+		if err != nil {
+			return nil, err
+		}
+		count, _ := json.Marshal(node.NumRepeated + 1)
+		elements.Entries = append(elements.Entries, [2]json.RawMessage{key, count})
+	}
+	return json.Marshal(&elements)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, see FromJSON.
+//
+// If the tree has no comparator the one registered for the recorded key type is used.
+// Entries must be sorted by key without duplicates and have positive counts,
+// otherwise an error is returned and the tree is left unchanged.
+// Keys of an unregistered key type are decoded into the type of the keys the tree holds,
+// ErrNoKeyType is returned if the tree is empty.
+//
+// Input that is not an object of version and entries, and optionally keyType, is read as the legacy
+// format: an object mapping keys to counts.
+func (tree *Tree) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if !isJSONTree(fields) {
+		return tree.unmarshalLegacyJSON(data)
+	}
+	var elements jsonTree
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return err
+	}
+	if elements.Version != jsonVersion {
+		return fmt.Errorf("redblacktree: unsupported JSON version %d", elements.Version)
+	}
+	newTree, keyType, err := newJSONTree(elements.KeyType, tree)
+	if err != nil {
+		return err
+	}
+	if keyType.Type == nil && len(elements.Entries) > 0 {
+		return ErrNoKeyType
+	}
+	index := 0
+	err = newTree.buildSorted(len(elements.Entries), func() (entry Entry, err error) {
+		entry, err = decodeJSONEntry(index, elements.Entries[index], keyType)
+		index++
+		return entry, err
+	})
+	if err != nil {
+		return err
+	}
+	tree.replaceWith(newTree)
+	return nil
+}
+
+// isJSONTree reports whether the fields of an object are those of a jsonTree rather than legacy keys.
+func isJSONTree(fields map[string]json.RawMessage) bool {
+	_, hasVersion := fields["version"]
+	_, hasEntries := fields["entries"]
+	_, hasKeyType := fields["keyType"]
+	expected := 2
+	if hasKeyType {
+		expected++
+	}
+	return hasVersion && hasEntries && len(fields) == expected
+}
+
+// newJSONTree returns an empty tree for keys of the recorded key type, using the comparator of tree
+// if not nil and otherwise the one registered for the key type. For an empty key type name the returned
+// key type holds the type of tree's keys, see Tree.keyType, and its Type is nil if that is unknown.
+func newJSONTree(name string, tree *Tree) (*Tree, utils.KeyType, error) {
+	comparator := tree.Comparator
+	keyType, known := utils.KeyTypeByName(name)
+	if !known && name != "" {
+		return nil, keyType, fmt.Errorf("redblacktree: unknown key type %q", name)
+	}
+	if comparator == nil {
+		if !known {
+			return nil, keyType, fmt.Errorf("redblacktree: no comparator for key type %q", name)
+		}
+		comparator = keyType.Comparator
+	} else if known {
+		if err := matchKeyType(name, comparator); err != nil {
+			return nil, keyType, err
+		}
+	} else if keyType.Type = tree.keyType(); keyType.Type != nil {
+		keyType.Name = keyType.Type.String()
+	}
+	return NewWith(comparator), keyType, nil
+}
+
+// keyType returns the type registered for the tree's comparator, see utils.RegisterKeyType,
+// or else the type of the keys the tree holds, nil if neither is known.
+func (tree *Tree) keyType() reflect.Type {
+	if keyType, found := utils.KeyTypeOf(tree.Comparator); found {
+		return keyType.Type
+	}
+	if tree.Root != nil {
+		return reflect.TypeOf(tree.Root.Key)
+	}
+	return nil
+}
+
+// matchKeyType returns an error if comparator is registered for a key type other than the one named.
+func matchKeyType(name string, comparator utils.Comparator) error {
+	if keyType, found := utils.KeyTypeOf(comparator); found && keyType.Name != name {
+		return fmt.Errorf("redblacktree: key type %q does not match tree's %q", name, keyType.Name)
+	}
+	return nil
+}
+
+// decodeJSONEntry decodes the index-th [key, count] pair, decoding the key into keyType.Type.
+func decodeJSONEntry(index int, raw [2]json.RawMessage, keyType utils.KeyType) (entry Entry, err error) {
+	ptr := reflect.New(keyType.Type)
+	if err := json.Unmarshal(raw[0], ptr.Interface()); err != nil {
+		return entry, fmt.Errorf("redblacktree: entry %d: invalid %s key: %v", index, keyType.Name, err)
+	}
+	entry.Key = ptr.Elem().Interface()
+	if err := json.Unmarshal(raw[1], &entry.Count); err != nil {
+		return entry, fmt.Errorf("redblacktree: entry %d: invalid count: %v", index, err)
+	}
+	return entry, nil
+}
+
+// unmarshalLegacyJSON reads the legacy format, whose keys are strings.
+// Without a comparator the keys are kept as strings, see UnmarshalJSON for how the key type is found otherwise.
+func (tree *Tree) unmarshalLegacyJSON(data []byte) error {
 	elements := make(map[string]int)
-	err := json.Unmarshal(data, &elements)
-	if err == nil {
-		tree.Clear()
-		for key, value := range elements {
-			for i := 0; i < value; i++ {
-				tree.Put(key)
-			}
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return err
+	}
+	for key, count := range elements {
+		if count <= 0 {
+			return fmt.Errorf("redblacktree: count of key %q must be positive, got %d", key, count)
+		}
+	}
+	comparator := tree.Comparator
+	if comparator == nil {
+		comparator = utils.StringComparator
+	} else if err := matchKeyType("string", comparator); err != nil {
+		return err
+	}
+	keyType := reflect.TypeOf("")
+	if tree.Comparator != nil {
+		keyType = tree.keyType()
+	}
+	if keyType == nil && len(elements) > 0 {
+		return ErrNoKeyType
+	}
+	newTree := NewWith(comparator)
+	for key, count := range elements {
+		if keyType.Kind() != reflect.String {
+			return fmt.Errorf("redblacktree: legacy JSON key %q does not match tree's %s keys", key, keyType)
 		}
+		newTree.PutN(reflect.ValueOf(key).Convert(keyType).Interface(), count)
 	}
-	return err
+	tree.replaceWith(newTree)
+	return nil
 }
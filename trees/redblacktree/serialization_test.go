@@ -0,0 +1,193 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func TestRedBlackTreeJSONFormat(t *testing.T) {
+	tree := NewWithIntComparator()
+	for _, key := range []int{3, -1, 2, 3, 3} {
+		tree.Put(key)
+	}
+	data, err := tree.ToJSON()
+	if err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	if actualValue, expectedValue := string(data), `{"version":1,"keyType":"int","entries":[[-1,1],[2,1],[3,3]]}`; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	data, _ = NewWithStringComparator().ToJSON()
+	if actualValue, expectedValue := string(data), `{"version":1,"keyType":"string","entries":[]}`; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	data, _ = NewWith(func(a, b interface{}) int { return utils.IntComparator(a, b) }).ToJSON()
+	if actualValue, expectedValue := string(data), `{"version":1,"entries":[]}`; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeJSONRoundTrip(t *testing.T) {
+	now := time.Date(2020, 5, 17, 10, 0, 0, 0, time.UTC)
+	trees := []*Tree{
+		NewWithIntComparator(),
+		NewWithFloat64Comparator(),
+		NewWithStringComparator(),
+		NewWith(utils.UInt8Comparator),
+		NewWith(utils.TimeComparator),
+	}
+	keys := [][]interface{}{
+		{5, -3, 5, 0},
+		{1.5, -2.25, 1.5},
+		{"b", "a", "b", "c"},
+		{uint8(200), uint8(1), uint8(1)},
+		{now, now.Add(time.Hour), now},
+	}
+	for i, tree := range trees {
+		for _, key := range keys[i] {
+			tree.Put(key)
+		}
+		data, err := json.Marshal(tree)
+		if err != nil {
+			t.Errorf("Got error %v", err)
+		}
+		restored := &Tree{}
+		if err := json.Unmarshal(data, restored); err != nil {
+			t.Errorf("Got error %v", err)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), fmt.Sprintf("%v", tree.Keys()); actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+		if actualValue, expectedValue := restored.CountSmaller(keys[i][0]), tree.CountSmaller(keys[i][0]); actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+}
+
+func TestRedBlackTreeJSONEmbedded(t *testing.T) {
+	type histogram struct {
+		Name   string
+		Counts *Tree
+	}
+	h := histogram{Name: "h", Counts: NewWithIntComparator()}
+	h.Counts.Put(7)
+	h.Counts.Put(7)
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	var restored histogram
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	if actualValue, expectedValue := restored.Counts.CountGreaterOrEqual(7), 2; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeJSONInvalid(t *testing.T) {
+	tests := [][]string{
+		{`{"version":2,"entries":[]}`, "unsupported JSON version 2"},
+		{`{"version":1,"keyType":"complex","entries":[]}`, `unknown key type "complex"`},
+		{`{"version":1,"keyType":"int","entries":[[1,0]]}`, "entry 0: count of key 1 must be positive, got 0"},
+		{`{"version":1,"keyType":"int","entries":[[1,1],[2,-4]]}`, "entry 1: count of key 2 must be positive, got -4"},
+		{`{"version":1,"keyType":"int","entries":[[1,1],[1,2]]}`, "entry 1: duplicate key 1"},
+		{`{"version":1,"keyType":"int","entries":[[2,1],[1,2]]}`, "entry 1: key 1 is not sorted after 2"},
+		{`{"version":1,"keyType":"int","entries":[["a",1]]}`, "entry 0: invalid int key"},
+		{`{"version":1,"keyType":"int","entries":[[1,1.5]]}`, "entry 0: invalid count"},
+		{`{"version":1,"keyType":"string","entries":[["a",1]]}`, `key type "string" does not match tree's "int"`},
+		{`{"a":-1}`, `count of key "a" must be positive, got -1`},
+		{`{"a":1}`, `key type "string" does not match tree's "int"`},
+		{`{"version":1,"entries":5}`, "cannot unmarshal number"},
+		{`{"version":1,"keyType":"int","entries":[],"a":1}`, "cannot unmarshal"},
+	}
+	for _, test := range tests {
+		tree := NewWithIntComparator()
+		tree.Put(42)
+		err := tree.FromJSON([]byte(test[0]))
+		if err == nil || !strings.Contains(err.Error(), test[1]) {
+			t.Errorf("Got %v expected %v", err, test[1])
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[42]"; actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+
+	if err := (&Tree{}).FromJSON([]byte(`{"version":1,"entries":[[1,1]]}`)); err == nil {
+		t.Errorf("Expected error for missing comparator")
+	}
+}
+
+func TestRedBlackTreeJSONLegacy(t *testing.T) {
+	tree := NewWithStringComparator()
+	if err := tree.FromJSON([]byte(`{"b":2,"a":1}`)); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[a b b]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	// a key named version does not make the legacy object the versioned format
+	if err := tree.FromJSON([]byte(`{"version":1,"a":2}`)); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[a a version]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+
+	custom := NewWith(func(a, b interface{}) int { return utils.StringComparator(a, b) })
+	if err := custom.FromJSON([]byte(`{"a":1}`)); err != ErrNoKeyType {
+		t.Errorf("Got %v expected %v", err, ErrNoKeyType)
+	}
+	custom.Put("z")
+	if err := custom.FromJSON([]byte(`{"b":2,"a":1}`)); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	if actualValue, expectedValue := fmt.Sprintf("%v", custom.Keys()), "[a b b]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+	ints := NewWith(func(a, b interface{}) int { return utils.IntComparator(a, b) })
+	ints.Put(1)
+	if err := ints.FromJSON([]byte(`{"a":1}`)); err == nil || !strings.Contains(err.Error(), "does not match tree's int keys") {
+		t.Errorf("Got %v expected legacy key mismatch", err)
+	}
+}
+
+func TestRedBlackTreeJSONUnregisteredKeyType(t *testing.T) {
+	comparator := func(a, b interface{}) int { return utils.IntComparator(a, b) }
+	tree := NewWith(comparator)
+	for _, key := range []int{3, 1, 3} {
+		tree.Put(key)
+	}
+	data, err := tree.ToJSON()
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+
+	if err := NewWith(comparator).FromJSON(data); err != ErrNoKeyType {
+		t.Errorf("Got %v expected %v", err, ErrNoKeyType)
+	}
+	if err := NewWith(comparator).FromJSON([]byte(`{"version":1,"entries":[]}`)); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	restored := NewWith(comparator)
+	restored.Put(7)
+	if err := restored.FromJSON(data); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	restored.Put(2)
+	if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), "[1 2 3 3]"; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/afiodorov/countedredblacktree/trees/redblacktree/internal/wire"
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+// The snapshot file format is
+//
+//	magic    "CRBTSNAP"
+//	version  byte
+//	keyType  uvarint length followed by the name of the key type, see utils.RegisterKeyType
+//	encoding byte, binaryKeysCodec or binaryKeysDelta
+//	entries  key followed by uvarint count per distinct key in-order, see MarshalBinary
+//	distinct uint64 little-endian number of distinct keys
+//	size     uint64 little-endian number of elements
+//	checksum uint32 little-endian CRC-32C of all preceding bytes
+//
+// Counts trail the entries so snapshots can be written in one pass.
+const (
+	snapshotMagic       = "CRBTSNAP"
+	snapshotVersion     = 1
+	snapshotTrailerSize = 8 + 8 + 4
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Errors reported by LoadSnapshot wrapped in a *SnapshotError.
+var (
+	ErrSnapshotFormat    = errors.New("not a snapshot or unsupported version")
+	ErrSnapshotTruncated = errors.New("snapshot truncated")
+	ErrSnapshotCorrupt   = errors.New("snapshot corrupt")
+	ErrSnapshotKeyType   = errors.New("snapshot key type does not match comparator")
+)
+
+// SnapshotError records the snapshot file an error occurred with.
+// Use errors.Is to check for ErrSnapshotFormat, ErrSnapshotTruncated, ErrSnapshotCorrupt or ErrSnapshotKeyType.
+type SnapshotError struct {
+	Path string
+	Err  error
+}
+
+func (e *SnapshotError) Error() string {
+	return "redblacktree: " + e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SnapshotError) Unwrap() error {
+	return e.Err
+}
+
+// SaveSnapshot atomically replaces the file at path with a checksummed snapshot of the tree.
+// The snapshot is written to a temporary file in the same directory, synced to disk and renamed over path,
+// so a crash leaves either the previous or the new snapshot in place.
+// The tree's comparator must be registered with utils.RegisterKeyType.
+func (tree *Tree) SaveSnapshot(path string) error {
+	_, err := tree.saveSnapshot(path)
+	return err
+}
+
+// saveSnapshot is SaveSnapshot returning the trailer of the written snapshot.
+func (tree *Tree) saveSnapshot(path string) (trailer [snapshotTrailerSize]byte, err error) {
+	keyType, found := utils.KeyTypeOf(tree.Comparator)
+	if !found {
+		return trailer, ErrNoKeyType
+	}
+	sw, err := createSnapshot(path, keyType, tree.keyEncoding(keyType.Codec))
+	if err != nil {
+		return trailer, err
+	}
+	for node := tree.Left(); node != nil; node = node.successor() {
+		if err := sw.write(Entry{Key: node.Key, Count: node.NumRepeated + 1}); err != nil {
+			sw.abort()
+			return trailer, err
+		}
+	}
+	err = sw.commit()
+	return sw.trailer, err
+}
+
+// LoadSnapshot replaces the tree's content with the snapshot at path, building the tree in O(n).
+// If the tree has no comparator the one registered for the recorded key type is used.
+// The whole file is verified before the tree is modified: on error the tree is left unchanged
+// and the error is a *SnapshotError unless the file could not be opened.
+func (tree *Tree) LoadSnapshot(path string) error {
+	_, err := tree.loadSnapshot(path)
+	return err
+}
+
+// loadSnapshot is LoadSnapshot returning the trailer of the loaded snapshot.
+func (tree *Tree) loadSnapshot(path string) ([snapshotTrailerSize]byte, error) {
+	var trailer [snapshotTrailerSize]byte
+	sr, err := openSnapshot(path)
+	if err != nil {
+		return trailer, err
+	}
+	defer sr.file.Close()
+	comparator := tree.Comparator
+	if comparator == nil {
+		comparator = sr.decoder.keyType.Comparator
+	} else if keyType, _ := utils.KeyTypeOf(comparator); keyType.Name != sr.decoder.keyType.Name {
+		return trailer, sr.error(fmt.Errorf("%w: %q", ErrSnapshotKeyType, sr.decoder.keyType.Name))
+	}
+	newTree := NewWith(comparator)
+	if err := newTree.buildSorted(int(sr.distinct), sr.next); err != nil {
+		return trailer, sr.error(err)
+	}
+	if err := sr.verify(); err != nil {
+		return trailer, err
+	}
+	if uint64(newTree.Size()) != sr.size {
+		return trailer, sr.error(fmt.Errorf("%w: %d elements recorded but %d read", ErrSnapshotCorrupt, sr.size, newTree.Size()))
+	}
+	tree.replaceWith(newTree)
+	return sr.trailer, nil
+}
+
+// snapshotWriter writes a snapshot entry by entry to a temporary file renamed into place by commit.
+type snapshotWriter struct {
+	path     string
+	file     *os.File
+	buf      *bufio.Writer
+	crc      hash.Hash32
+	bw       *wire.Writer
+	encoder  entryEncoder
+	distinct uint64
+	size     uint64
+	trailer  [snapshotTrailerSize]byte
+}
+
+func createSnapshot(path string, keyType utils.KeyType, keyEncoding byte) (*snapshotWriter, error) {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	sw := &snapshotWriter{path: path, file: file, buf: bufio.NewWriter(file), crc: crc32.New(castagnoli)}
+	sw.bw = &wire.Writer{W: io.MultiWriter(sw.buf, sw.crc)}
+	sw.encoder = entryEncoder{bw: sw.bw, codec: keyType.Codec, keyEncoding: keyEncoding}
+	sw.bw.Write([]byte(snapshotMagic))
+	sw.bw.Write([]byte{snapshotVersion})
+	sw.bw.WriteBytes([]byte(keyType.Name))
+	sw.bw.Write([]byte{keyEncoding})
+	if sw.bw.Err != nil {
+		sw.abort()
+		return nil, sw.bw.Err
+	}
+	return sw, nil
+}
+
+// write appends the next entry, entries must be written in-order.
+func (sw *snapshotWriter) write(entry Entry) error {
+	sw.encoder.encode(entry)
+	sw.distinct++
+	sw.size += uint64(entry.Count)
+	return sw.bw.Err
+}
+
+// commit writes the trailer, syncs the temporary file and renames it over the snapshot path.
+func (sw *snapshotWriter) commit() error {
+	trailer := &sw.trailer
+	binary.LittleEndian.PutUint64(trailer[0:], sw.distinct)
+	binary.LittleEndian.PutUint64(trailer[8:], sw.size)
+	sw.bw.Write(trailer[:16])
+	binary.LittleEndian.PutUint32(trailer[16:], sw.crc.Sum32())
+	if sw.bw.Err == nil {
+		_, sw.bw.Err = sw.buf.Write(trailer[16:])
+	}
+	err := sw.bw.Err
+	if err == nil {
+		err = sw.buf.Flush()
+	}
+	if err == nil {
+		err = sw.file.Sync()
+	}
+	if err != nil {
+		sw.abort()
+		return err
+	}
+	if err := sw.file.Close(); err != nil {
+		os.Remove(sw.file.Name())
+		return err
+	}
+	if err := os.Rename(sw.file.Name(), sw.path); err != nil {
+		os.Remove(sw.file.Name())
+		return err
+	}
+	syncDir(filepath.Dir(sw.path))
+	return nil
+}
+
+// abort discards the temporary file.
+func (sw *snapshotWriter) abort() {
+	sw.file.Close()
+	os.Remove(sw.file.Name())
+}
+
+// syncDir makes a rename in the directory durable where the platform supports it.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// snapshotReader reads the entries of a snapshot in-order, checksumming everything it reads.
+type snapshotReader struct {
+	path     string
+	file     *os.File
+	limited  *io.LimitedReader
+	crc      hash.Hash32
+	br       *wire.Reader
+	decoder  *entryDecoder
+	trailer  [snapshotTrailerSize]byte
+	distinct uint64
+	size     uint64
+}
+
+func openSnapshot(path string) (*snapshotReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sr := &snapshotReader{path: path, file: file, crc: crc32.New(castagnoli)}
+	if err := sr.open(); err != nil {
+		file.Close()
+		return nil, sr.error(err)
+	}
+	return sr, nil
+}
+
+func (sr *snapshotReader) open() error {
+	info, err := sr.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < int64(len(snapshotMagic)+2+snapshotTrailerSize) {
+		return ErrSnapshotTruncated
+	}
+	if _, err := sr.file.ReadAt(sr.trailer[:], info.Size()-snapshotTrailerSize); err != nil {
+		return err
+	}
+	sr.distinct = binary.LittleEndian.Uint64(sr.trailer[0:])
+	sr.size = binary.LittleEndian.Uint64(sr.trailer[8:])
+
+	sr.limited = &io.LimitedReader{R: sr.file, N: info.Size() - snapshotTrailerSize}
+	sr.br = &wire.Reader{R: bufio.NewReader(io.TeeReader(sr.limited, sr.crc))}
+	magic := sr.br.Read(len(snapshotMagic))
+	version := sr.br.Read(1)
+	if sr.br.Err == nil && (string(magic) != snapshotMagic || version[0] != snapshotVersion) {
+		return ErrSnapshotFormat
+	}
+	name := string(sr.br.ReadBytes())
+	keyEncoding := sr.br.Read(1)
+	if sr.br.Err != nil {
+		return sr.readError(sr.br.Err)
+	}
+	if remaining := sr.remaining(); sr.distinct > uint64(remaining) {
+		return fmt.Errorf("%w: %d keys recorded in %d bytes", ErrSnapshotTruncated, sr.distinct, remaining)
+	}
+	sr.decoder, err = newEntryDecoder(sr.br, name, keyEncoding[0])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	return nil
+}
+
+// next returns the next entry, see entryDecoder.
+func (sr *snapshotReader) next() (Entry, error) {
+	entry, err := sr.decoder.decode()
+	if err != nil {
+		return entry, sr.readError(err)
+	}
+	return entry, nil
+}
+
+// verify checks that all entries were read and the checksum matches.
+func (sr *snapshotReader) verify() error {
+	if sr.remaining() != 0 {
+		return sr.error(fmt.Errorf("%w: trailing bytes after %d keys", ErrSnapshotCorrupt, sr.distinct))
+	}
+	sr.crc.Write(sr.trailer[:16])
+	if sr.crc.Sum32() != binary.LittleEndian.Uint32(sr.trailer[16:]) {
+		return sr.error(fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt))
+	}
+	return nil
+}
+
+// remaining returns the number of bytes left before the trailer.
+func (sr *snapshotReader) remaining() int64 {
+	return sr.limited.N + int64(sr.br.R.(*bufio.Reader).Buffered())
+}
+
+// readError classifies errors while decoding.
+func (sr *snapshotReader) readError(err error) error {
+	if err == io.ErrUnexpectedEOF {
+		return ErrSnapshotTruncated
+	}
+	return fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+}
+
+func (sr *snapshotReader) error(err error) error {
+	if _, ok := err.(*SnapshotError); ok {
+		return err
+	}
+	if !errors.Is(err, ErrSnapshotFormat) && !errors.Is(err, ErrSnapshotTruncated) &&
+		!errors.Is(err, ErrSnapshotCorrupt) && !errors.Is(err, ErrSnapshotKeyType) {
+		err = fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	return &SnapshotError{Path: sr.path, Err: err}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedBlackTreeSnapshotRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redblacktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tree.snap")
+
+	strs := NewWithStringComparator()
+	for _, key := range []string{"b", "a", "b", "c"} {
+		strs.Put(key)
+	}
+	ints := NewWithIntComparator()
+	for i := 0; i < 3000; i++ {
+		ints.PutN(i*7-3000, i%5+1)
+	}
+	for _, tree := range []*Tree{ints, strs, NewWithIntComparator()} {
+		if err := tree.SaveSnapshot(path); err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		restored := &Tree{}
+		if err := restored.LoadSnapshot(path); err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		assertValidTree(t, restored)
+		if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), fmt.Sprintf("%v", tree.Keys()); actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if actualValue, expectedValue := len(files), 1; actualValue != expectedValue {
+		t.Errorf("Got %v files expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeSnapshotInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redblacktree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tree.snap")
+	tree := NewWithIntComparator()
+	for i := 0; i < 100; i++ {
+		tree.PutN(i*7-100, i%5+1)
+	}
+	if err := tree.SaveSnapshot(path); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	valid, _ := ioutil.ReadFile(path)
+
+	corrupt := func(i int) []byte {
+		data := append([]byte(nil), valid...)
+		data[i] ^= 0x10
+		return data
+	}
+	tests := []struct {
+		data []byte
+		err  error
+	}{
+		{valid[:10], ErrSnapshotTruncated},
+		{valid[:len(valid)/2], ErrSnapshotTruncated},
+		{corrupt(0), ErrSnapshotFormat},
+		{corrupt(len(valid) / 2), ErrSnapshotCorrupt},
+		{corrupt(len(valid) - 1), ErrSnapshotCorrupt},
+		{corrupt(len(valid) - snapshotTrailerSize + 8), ErrSnapshotCorrupt},
+		{[]byte("just some text that is long enough to look like a snapshot"), ErrSnapshotFormat},
+	}
+	for i, test := range tests {
+		if err := ioutil.WriteFile(path, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		tree := NewWithIntComparator()
+		tree.Put(42)
+		err := tree.LoadSnapshot(path)
+		var snapshotErr *SnapshotError
+		if !errors.Is(err, test.err) || !errors.As(err, &snapshotErr) || snapshotErr.Path != path {
+			t.Errorf("%d: Got %v expected %v", i, err, test.err)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", tree.Keys()), "[42]"; actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+
+	ioutil.WriteFile(path, valid, 0644)
+	if err := NewWithStringComparator().LoadSnapshot(path); !errors.Is(err, ErrSnapshotKeyType) {
+		t.Errorf("Got %v expected %v", err, ErrSnapshotKeyType)
+	}
+	if err := NewWithIntComparator().LoadSnapshot(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("Got %v expected not exist error", err)
+	}
+	unregistered := NewWith(func(a, b interface{}) int { return 0 })
+	if err := unregistered.SaveSnapshot(path); err != ErrNoKeyType {
+		t.Errorf("Got %v expected %v", err, ErrNoKeyType)
+	}
+}
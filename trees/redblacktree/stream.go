@@ -0,0 +1,233 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+func assertStreamImplementation() {
+	var _ io.WriterTo = (*Tree)(nil)
+	var _ io.ReaderFrom = (*Tree)(nil)
+}
+
+// StreamFormat selects the format used by WriteStream and ReadStream.
+type StreamFormat int
+
+const (
+	// StreamBinary is the binary format, see MarshalBinary.
+	StreamBinary StreamFormat = iota
+
+	// StreamJSONLines is a header line followed by one [key, count] line per entry in-order:
+	//
+	//	{"version":1,"keyType":"int","entries":2}
+	//	[1,3]
+	//	[2,1]
+	StreamJSONLines
+)
+
+// streamProgressInterval is the number of entries between cancellation checks and progress reports.
+const streamProgressInterval = 4096
+
+// StreamOptions configures WriteStream and ReadStream.
+type StreamOptions struct {
+	Format StreamFormat
+
+	// Progress, if not nil, is called every few thousand entries and once at the end
+	// with the number of entries streamed so far.
+	Progress func(entries int)
+}
+
+// WriteTo implements io.WriterTo, streaming the tree in the binary format.
+func (tree *Tree) WriteTo(w io.Writer) (int64, error) {
+	return tree.WriteStream(context.Background(), w, StreamOptions{})
+}
+
+// ReadFrom implements io.ReaderFrom, reading a tree in the binary format, see ReadStream.
+func (tree *Tree) ReadFrom(r io.Reader) (int64, error) {
+	return tree.ReadStream(context.Background(), r, StreamOptions{})
+}
+
+// WriteStream writes the tree's entries in-order in the given format using memory independent of the tree size.
+// Returns the number of bytes written. Stops with ctx.Err() if ctx is cancelled.
+func (tree *Tree) WriteStream(ctx context.Context, w io.Writer, options StreamOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	progress := streamProgress{ctx: ctx, report: options.Progress}
+	var err error
+	switch options.Format {
+	case StreamBinary:
+		err = tree.writeBinary(bw, progress.step)
+	case StreamJSONLines:
+		err = tree.writeJSONLines(bw, progress.step)
+	default:
+		err = fmt.Errorf("redblacktree: unknown stream format %d", options.Format)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		progress.done()
+	}
+	return cw.n, err
+}
+
+// ReadStream replaces the tree's content with entries read in the given format,
+// building the tree bottom-up in O(n) as entries arrive without buffering them.
+// Returns the number of bytes consumed, the reader may have been read past that if it is not an io.ByteReader.
+// If the tree has no comparator the one registered for the recorded key type is used.
+// Stops with ctx.Err() if ctx is cancelled. On error the tree is left unchanged.
+func (tree *Tree) ReadStream(ctx context.Context, r io.Reader, options StreamOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	progress := streamProgress{ctx: ctx, report: options.Progress}
+	var newTree *Tree
+	var n int64
+	var err error
+	switch options.Format {
+	case StreamBinary:
+		byteReader, ok := r.(io.ByteReader)
+		if !ok {
+			byteReader = bufio.NewReader(r)
+		}
+		cr := &countingByteReader{r: byteReader}
+		newTree, err = readBinary(cr, tree.Comparator, progress.step)
+		n = cr.n
+	case StreamJSONLines:
+		newTree, n, err = readJSONLines(r, tree, progress.step)
+	default:
+		err = fmt.Errorf("redblacktree: unknown stream format %d", options.Format)
+	}
+	if err != nil {
+		return n, err
+	}
+	tree.replaceWith(newTree)
+	progress.done()
+	return n, nil
+}
+
+type jsonLinesHeader struct {
+	Version int    `json:"version"`
+	KeyType string `json:"keyType,omitempty"`
+	Entries int    `json:"entries"`
+}
+
+func (tree *Tree) writeJSONLines(w io.Writer, step func() error) error {
+	header := jsonLinesHeader{Version: jsonVersion, Entries: tree.distinct()}
+	if keyType, found := utils.KeyTypeOf(tree.Comparator); found {
+		header.KeyType = keyType.Name
+	}
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(&header); err != nil {
+		return err
+	}
+	for node := tree.Left(); node != nil; node = node.successor() {
+		if err := encoder.Encode([]interface{}{node.Key, node.NumRepeated + 1}); err != nil {
+			return err
+		}
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readJSONLines(r io.Reader, tree *Tree, step func() error) (*Tree, int64, error) {
+	decoder := json.NewDecoder(r)
+	var header jsonLinesHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, decoder.InputOffset(), err
+	}
+	if header.Version != jsonVersion {
+		return nil, decoder.InputOffset(), fmt.Errorf("redblacktree: unsupported JSON version %d", header.Version)
+	}
+	if header.Entries < 0 {
+		return nil, decoder.InputOffset(), fmt.Errorf("redblacktree: invalid number of entries %d", header.Entries)
+	}
+	newTree, keyType, err := newJSONTree(header.KeyType, tree)
+	if err != nil {
+		return nil, decoder.InputOffset(), err
+	}
+	if keyType.Type == nil && header.Entries > 0 {
+		return nil, decoder.InputOffset(), ErrNoKeyType
+	}
+	index := 0
+	err = newTree.buildSorted(header.Entries, func() (entry Entry, err error) {
+		var raw [2]json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return entry, fmt.Errorf("redblacktree: entry %d: %v", index, err)
+		}
+		if entry, err = decodeJSONEntry(index, raw, keyType); err != nil {
+			return entry, err
+		}
+		index++
+		return entry, step()
+	})
+	return newTree, decoder.InputOffset(), err
+}
+
+// streamProgress checks for cancellation and reports progress every streamProgressInterval entries.
+type streamProgress struct {
+	ctx     context.Context
+	report  func(entries int)
+	entries int
+}
+
+func (progress *streamProgress) step() error {
+	progress.entries++
+	if progress.entries%streamProgressInterval != 0 {
+		return nil
+	}
+	if err := progress.ctx.Err(); err != nil {
+		return err
+	}
+	if progress.report != nil {
+		progress.report(progress.entries)
+	}
+	return nil
+}
+
+func (progress *streamProgress) done() {
+	if progress.report != nil {
+		progress.report(progress.entries)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type countingByteReader struct {
+	r io.ByteReader
+	n int64
+}
+
+func (cr *countingByteReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return b, err
+}
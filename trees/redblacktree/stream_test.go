@@ -0,0 +1,146 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedBlackTreeStreamRoundTrip(t *testing.T) {
+	tree := NewWithIntComparator()
+	for i := 0; i < 10000; i++ {
+		tree.PutN(i*7-10000, i%5+1)
+	}
+	for _, format := range []StreamFormat{StreamBinary, StreamJSONLines} {
+		var buf bytes.Buffer
+		var reports []int
+		options := StreamOptions{Format: format, Progress: func(entries int) { reports = append(reports, entries) }}
+		written, err := tree.WriteStream(context.Background(), &buf, options)
+		if err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		if actualValue, expectedValue := written, int64(buf.Len()); actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", reports), "[4096 8192 10000]"; actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+
+		restored := &Tree{}
+		read, err := restored.ReadStream(context.Background(), &buf, StreamOptions{Format: format})
+		if err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		// the trailing newline of JSON lines is not part of the last value
+		if format == StreamBinary && read != written || format == StreamJSONLines && read != written-1 {
+			t.Errorf("Got %v expected %v", read, written)
+		}
+		assertValidTree(t, restored)
+		if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), fmt.Sprintf("%v", tree.Keys()); actualValue != expectedValue {
+			t.Errorf("Keys differ after round trip in format %v", format)
+		}
+	}
+}
+
+func TestRedBlackTreeStreamJSONLinesFormat(t *testing.T) {
+	tree := NewWithStringComparator()
+	tree.Put("b")
+	tree.Put("a")
+	tree.Put("b")
+	var buf bytes.Buffer
+	if _, err := tree.WriteStream(context.Background(), &buf, StreamOptions{Format: StreamJSONLines}); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if actualValue, expectedValue := buf.String(), "{\"version\":1,\"keyType\":\"string\",\"entries\":2}\n[\"a\",1]\n[\"b\",2]\n"; actualValue != expectedValue {
+		t.Errorf("Got %q expected %q", actualValue, expectedValue)
+	}
+}
+
+func TestRedBlackTreeWriteToReadFrom(t *testing.T) {
+	first, second := NewWithIntComparator(), NewWithIntComparator()
+	for i := 0; i < 100; i++ {
+		first.PutN(i*7-100, i%5+1)
+	}
+	for i := 0; i < 3; i++ {
+		second.PutN(i*7-3, i%5+1)
+	}
+	var buf bytes.Buffer
+	n1, err := first.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	n2, err := second.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+
+	// a bytes.Reader is an io.ByteReader so each tree consumes exactly its own bytes
+	r := bytes.NewReader(buf.Bytes())
+	for _, test := range []struct {
+		tree *Tree
+		n    int64
+	}{{first, n1}, {second, n2}} {
+		restored := NewWithIntComparator()
+		n, err := restored.ReadFrom(r)
+		if err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		if n != test.n {
+			t.Errorf("Got %v expected %v", n, test.n)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), fmt.Sprintf("%v", test.tree.Keys()); actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+}
+
+func TestRedBlackTreeStreamCancel(t *testing.T) {
+	tree := NewWithIntComparator()
+	for i := 0; i < 10000; i++ {
+		tree.PutN(i*7-10000, i%5+1)
+	}
+	for _, format := range []StreamFormat{StreamBinary, StreamJSONLines} {
+		var buf bytes.Buffer
+		ctx, cancel := context.WithCancel(context.Background())
+		options := StreamOptions{Format: format, Progress: func(int) { cancel() }}
+		if _, err := tree.WriteStream(ctx, &buf, options); err != context.Canceled {
+			t.Errorf("Got %v expected %v", err, context.Canceled)
+		}
+
+		buf.Reset()
+		tree.WriteStream(context.Background(), &buf, StreamOptions{Format: format})
+		ctx, cancel = context.WithCancel(context.Background())
+		restored := NewWithIntComparator()
+		restored.Put(42)
+		options = StreamOptions{Format: format, Progress: func(int) { cancel() }}
+		if _, err := restored.ReadStream(ctx, &buf, options); err != context.Canceled {
+			t.Errorf("Got %v expected %v", err, context.Canceled)
+		}
+		if actualValue, expectedValue := fmt.Sprintf("%v", restored.Keys()), "[42]"; actualValue != expectedValue {
+			t.Errorf("Got %v expected %v", actualValue, expectedValue)
+		}
+	}
+}
+
+func TestRedBlackTreeStreamJSONLinesInvalid(t *testing.T) {
+	tests := [][]string{
+		{`{"version":2,"entries":0}`, "unsupported JSON version 2"},
+		{`{"version":1,"keyType":"int","entries":-1}`, "invalid number of entries -1"},
+		{"{\"version\":1,\"keyType\":\"int\",\"entries\":2}\n[1,1]\n", "entry 1: unexpected EOF"},
+		{"{\"version\":1,\"keyType\":\"int\",\"entries\":2}\n[1,1]\n[1,1]\n", "entry 1: duplicate key 1"},
+		{"{\"version\":1,\"keyType\":\"int\",\"entries\":1}\n[\"a\",1]\n", "entry 0: invalid int key"},
+	}
+	for _, test := range tests {
+		tree := NewWithIntComparator()
+		_, err := tree.ReadStream(context.Background(), strings.NewReader(test[0]), StreamOptions{Format: StreamJSONLines})
+		if err == nil || !strings.Contains(err.Error(), test[1]) {
+			t.Errorf("Got %v expected %v", err, test[1])
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// ErrInvalidTree is returned by Validate for a tree whose structure is broken.
+var ErrInvalidTree = errors.New("redblacktree: invalid tree")
+
+// Validate checks the invariants of the tree in O(n): keys are ordered by the comparator,
+// the root is black, no red node has a red child, every path from a node to its leaves has the
+// same number of black nodes, parent pointers match child pointers, NumRepeated is not negative
+// and NumChildren counts the elements below every node. Subtree hashes are checked too if hashing
+// is enabled. Errors wrap ErrInvalidTree.
+//
+// Building with the redblacktreedebug tag validates the tree after every mutation and panics on error.
+func (tree *Tree) Validate() error {
+	if tree.Root == nil {
+		return nil
+	}
+	if tree.Root.Parent != nil {
+		return fmt.Errorf("%w: root %v has a parent", ErrInvalidTree, tree.Root.Key)
+	}
+	if tree.Root.color == red {
+		return fmt.Errorf("%w: root %v is red", ErrInvalidTree, tree.Root.Key)
+	}
+	_, _, err := tree.validate(tree.Root, nil, nil)
+	return err
+}
+
+// validate checks the subtree rooted at node, whose keys must lie strictly between the non-nil
+// bounds, and returns its black height and size.
+func (tree *Tree) validate(node, lo, hi *Node) (blackHeight, size int, err error) {
+	if node == nil {
+		return 1, 0, nil
+	}
+	if lo != nil && tree.Comparator(lo.Key, node.Key) >= 0 {
+		return 0, 0, fmt.Errorf("%w: node %v is not ordered after %v", ErrInvalidTree, node.Key, lo.Key)
+	}
+	if hi != nil && tree.Comparator(node.Key, hi.Key) >= 0 {
+		return 0, 0, fmt.Errorf("%w: node %v is not ordered before %v", ErrInvalidTree, node.Key, hi.Key)
+	}
+	if node.NumRepeated < 0 {
+		return 0, 0, fmt.Errorf("%w: node %v has NumRepeated %d", ErrInvalidTree, node.Key, node.NumRepeated)
+	}
+	for _, child := range []*Node{node.Left, node.Right} {
+		if child == nil {
+			continue
+		}
+		if child.Parent != node {
+			return 0, 0, fmt.Errorf("%w: node %v has a wrong parent, expected %v", ErrInvalidTree, child.Key, node.Key)
+		}
+		if node.color == red && child.color == red {
+			return 0, 0, fmt.Errorf("%w: red node %v has red child %v", ErrInvalidTree, node.Key, child.Key)
+		}
+	}
+	leftHeight, leftSize, err := tree.validate(node.Left, lo, node)
+	if err != nil {
+		return 0, 0, err
+	}
+	rightHeight, rightSize, err := tree.validate(node.Right, node, hi)
+	if err != nil {
+		return 0, 0, err
+	}
+	if leftHeight != rightHeight {
+		return 0, 0, fmt.Errorf("%w: node %v has black heights %d and %d", ErrInvalidTree, node.Key, leftHeight, rightHeight)
+	}
+	if node.NumChildren != leftSize+rightSize {
+		return 0, 0, fmt.Errorf("%w: node %v has NumChildren %d, expected %d", ErrInvalidTree, node.Key, node.NumChildren, leftSize+rightSize)
+	}
+	if tree.hasher != nil {
+		if node.hashes == nil {
+			return 0, 0, fmt.Errorf("%w: node %v has no hashes", ErrInvalidTree, node.Key)
+		}
+		if hash := tree.hasher(node.Key, node.NumRepeated+1); node.hashes.hash != hash {
+			return 0, 0, fmt.Errorf("%w: node %v has hash %#x, expected %#x", ErrInvalidTree, node.Key, node.hashes.hash, hash)
+		}
+		if hash := node.Left.subtreeHash() + node.Right.subtreeHash(); node.hashes.childHash != hash {
+			return 0, 0, fmt.Errorf("%w: node %v has child hash %#x, expected %#x", ErrInvalidTree, node.Key, node.hashes.childHash, hash)
+		}
+	}
+	if node.color == black {
+		leftHeight++
+	}
+	return leftHeight, leftSize + rightSize + node.NumRepeated + 1, nil
+}
+
+// mustValidate panics if the tree is invalid, see Validate.
+func (tree *Tree) mustValidate() {
+	if err := tree.Validate(); err != nil {
+		panic(err)
+	}
+}
+
+// Stats summarizes the shape and contents of a tree.
+type Stats struct {
+	Height          int // number of nodes on the longest path from the root to a leaf
+	BlackHeight     int // number of black nodes on every path from the root to a leaf
+	Distinct        int // number of distinct keys, i.e. nodes
+	Size            int // number of elements counting repetitions
+	MaxMultiplicity int // largest count of a key
+	// EstimatedMemory is the number of bytes held by the tree and its nodes,
+	// not counting memory referenced by the keys.
+	EstimatedMemory int
+}
+
+// Stats returns statistics of the tree in O(n).
+func (tree *Tree) Stats() Stats {
+	stats := Stats{Size: tree.Size()}
+	var walk func(node *Node, depth int)
+	walk = func(node *Node, depth int) {
+		if node == nil {
+			return
+		}
+		stats.Distinct++
+		if depth > stats.Height {
+			stats.Height = depth
+		}
+		if count := node.NumRepeated + 1; count > stats.MaxMultiplicity {
+			stats.MaxMultiplicity = count
+		}
+		walk(node.Left, depth+1)
+		walk(node.Right, depth+1)
+	}
+	walk(tree.Root, 1)
+	for node := tree.Root; node != nil; node = node.Left {
+		if node.color == black {
+			stats.BlackHeight++
+		}
+	}
+	stats.EstimatedMemory = int(unsafe.Sizeof(Tree{})) + stats.Distinct*int(unsafe.Sizeof(Node{}))
+	if tree.hasher != nil {
+		stats.EstimatedMemory += stats.Distinct * int(unsafe.Sizeof(nodeHashes{}))
+	}
+	return stats
+}
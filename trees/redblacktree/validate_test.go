@@ -0,0 +1,104 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestRedBlackTreeValidate(t *testing.T) {
+	newTree := func() *Tree {
+		tree := NewWithIntComparator()
+		for i := 1; i <= 15; i++ {
+			tree.PutN(i, i%3+1)
+		}
+		return tree
+	}
+	if err := NewWithIntComparator().Validate(); err != nil {
+		t.Errorf("Empty tree is invalid: %v", err)
+	}
+	if err := newTree().Validate(); err != nil {
+		t.Errorf("Got %v expected a valid tree", err)
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(tree *Tree)
+		message string
+	}{
+		{"ordering", func(tree *Tree) { tree.Left().Key = 100 }, "is not ordered"},
+		{"red root", func(tree *Tree) { tree.Root.color = red }, "is red"},
+		{"root parent", func(tree *Tree) { tree.Root.Parent = tree.Root.Left }, "has a parent"},
+		{"red red", func(tree *Tree) {
+			node := tree.Left()
+			node.color, node.Parent.color = red, red
+		}, "has red child"},
+		{"black height", func(tree *Tree) {
+			node := tree.Left()
+			if node.color == black {
+				node.color = red
+			} else {
+				node.color = black
+			}
+		}, "black heights"},
+		{"parent", func(tree *Tree) { tree.Left().Parent = tree.Root }, "wrong parent"},
+		{"num children", func(tree *Tree) { tree.Root.Left.NumChildren++ }, "NumChildren"},
+		{"num repeated", func(tree *Tree) { tree.Left().NumRepeated = -1 }, "NumRepeated"},
+		{"hash", func(tree *Tree) {
+			tree.EnableHashing(func(key interface{}, count int) uint64 { return uint64(key.(int) * count) })
+			tree.Left().NumRepeated++
+			tree.Left().Parent.updateParentCounts()
+		}, "has hash"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := newTree()
+			test.corrupt(tree)
+			err := tree.Validate()
+			if !errors.Is(err, ErrInvalidTree) {
+				t.Fatalf("Got %v expected %v", err, ErrInvalidTree)
+			}
+			if !strings.Contains(err.Error(), test.message) {
+				t.Errorf("Got %q expected it to contain %q", err, test.message)
+			}
+		})
+	}
+}
+
+func TestRedBlackTreeStats(t *testing.T) {
+	tree := NewWithIntComparator()
+	if stats := tree.Stats(); stats != (Stats{EstimatedMemory: int(unsafe.Sizeof(Tree{}))}) {
+		t.Errorf("Got %+v for an empty tree", stats)
+	}
+	for i := 1; i <= 7; i++ {
+		tree.PutN(i, i)
+	}
+	stats := tree.Stats()
+	expected := Stats{
+		Height:          4,
+		BlackHeight:     2,
+		Distinct:        7,
+		Size:            28,
+		MaxMultiplicity: 7,
+		EstimatedMemory: int(unsafe.Sizeof(Tree{})) + 7*int(unsafe.Sizeof(Node{})),
+	}
+	if stats != expected {
+		t.Errorf("Got %+v expected %+v", stats, expected)
+	}
+
+	tree.buildSorted(7, func() func() (Entry, error) {
+		key := 0
+		return func() (Entry, error) {
+			key++
+			return Entry{Key: key, Count: 1}, nil
+		}
+	}())
+	if stats := tree.Stats(); stats.Height != 3 || stats.BlackHeight != 3 || stats.MaxMultiplicity != 1 {
+		t.Errorf("Got %+v for a perfect tree", stats)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"fmt"
+
+	"github.com/afiodorov/countedredblacktree/utils"
+)
+
+type measureKind int
+
+const (
+	measureCount measureKind = iota
+	measureCountGreater
+	measureCountSmaller
+	measureSize
+)
+
+// Measure is a number of elements of a tree watched by a Condition.
+type Measure struct {
+	kind measureKind
+	key  interface{}
+}
+
+// MeasureCount measures the number of repetitions of key.
+func MeasureCount(key interface{}) Measure {
+	return Measure{kind: measureCount, key: key}
+}
+
+// MeasureCountGreater measures the number of elements greater than key, see Tree.CountGreater.
+func MeasureCountGreater(key interface{}) Measure {
+	return Measure{kind: measureCountGreater, key: key}
+}
+
+// MeasureCountSmaller measures the number of elements smaller than key, see Tree.CountSmaller.
+func MeasureCountSmaller(key interface{}) Measure {
+	return Measure{kind: measureCountSmaller, key: key}
+}
+
+// MeasureSize measures the number of elements of the tree, see Tree.Size.
+func MeasureSize() Measure {
+	return Measure{kind: measureSize}
+}
+
+// AtLeast is the condition measure >= n.
+func (measure Measure) AtLeast(n int) Condition {
+	return Condition{measure: measure, op: ">=", threshold: n}
+}
+
+// AtMost is the condition measure <= n.
+func (measure Measure) AtMost(n int) Condition {
+	return Condition{measure: measure, op: "<=", threshold: n}
+}
+
+// Equals is the condition measure == n.
+func (measure Measure) Equals(n int) Condition {
+	return Condition{measure: measure, op: "==", threshold: n}
+}
+
+// String returns the measure as its constructor call, e.g. MeasureCountGreater(10).
+func (measure Measure) String() string {
+	switch measure.kind {
+	case measureCount:
+		return "MeasureCount(" + utils.ToString(measure.key) + ")"
+	case measureCountGreater:
+		return "MeasureCountGreater(" + utils.ToString(measure.key) + ")"
+	case measureCountSmaller:
+		return "MeasureCountSmaller(" + utils.ToString(measure.key) + ")"
+	default:
+		return "MeasureSize()"
+	}
+}
+
+// Condition compares a Measure with a threshold, see Tree.Watch.
+type Condition struct {
+	measure   Measure
+	op        string
+	threshold int
+}
+
+// Measure returns the measure compared by the condition.
+func (condition Condition) Measure() Measure {
+	return condition.measure
+}
+
+// String returns the condition, e.g. MeasureCountGreater(10) >= 100.
+func (condition Condition) String() string {
+	return fmt.Sprintf("%v %s %d", condition.measure, condition.op, condition.threshold)
+}
+
+// holds returns whether the condition is met by the value of its measure.
+func (condition Condition) holds(value int) bool {
+	switch condition.op {
+	case ">=":
+		return value >= condition.threshold
+	case "<=":
+		return value <= condition.threshold
+	default:
+		return value == condition.threshold
+	}
+}
+
+// Watcher calls a callback whenever its condition becomes met, see Tree.Watch.
+type Watcher struct {
+	tree      *Tree // nil once cancelled
+	condition Condition
+	callback  func(value int)
+	value     int
+	met       bool
+}
+
+// Watch calls callback with the value of the condition's measure whenever a mutation of the tree makes the
+// condition met while it was not, so it fires once on crossing the threshold and again only after crossing
+// back and forth. A condition already met when watched fires only after it is crossed again, see Met.
+//
+// The measure is computed in O(log n) when watching and after Clear or replacing the whole tree, and is
+// otherwise maintained incrementally: Put and Remove only update the watchers whose measure counts the
+// mutated key, comparing it once with each watcher's key.
+//
+// Callbacks are called synchronously after the mutation once all watchers are updated, with the value
+// reached by the mutation, and may modify the tree or cancel watchers.
+// Key should adhere to the comparator's type assertion, otherwise method panics.
+func (tree *Tree) Watch(condition Condition, callback func(value int)) *Watcher {
+	watcher := &Watcher{tree: tree, condition: condition, callback: callback}
+	watcher.value = tree.measure(condition.measure)
+	watcher.met = condition.holds(watcher.value)
+	tree.watchers = append(tree.watchers, watcher)
+	return watcher
+}
+
+// Condition returns the watched condition.
+func (watcher *Watcher) Condition() Condition {
+	return watcher.condition
+}
+
+// Value returns the current value of the condition's measure.
+func (watcher *Watcher) Value() int {
+	return watcher.value
+}
+
+// Met returns whether the condition is currently met.
+func (watcher *Watcher) Met() bool {
+	return watcher.met
+}
+
+// Cancel stops watching, the callback is not called afterwards.
+func (watcher *Watcher) Cancel() {
+	tree := watcher.tree
+	if tree == nil {
+		return
+	}
+	watcher.tree = nil
+	// copy so that a notification iterating over the watchers is not disturbed
+	watchers := make([]*Watcher, 0, len(tree.watchers)-1)
+	for _, other := range tree.watchers {
+		if other != watcher {
+			watchers = append(watchers, other)
+		}
+	}
+	if len(watchers) == 0 {
+		watchers = nil
+	}
+	tree.watchers = watchers
+}
+
+// update sets the value of the measure and returns whether the condition became met.
+func (watcher *Watcher) update(value int) bool {
+	watcher.value = value
+	met := watcher.condition.holds(value)
+	crossed := met && !watcher.met
+	watcher.met = met
+	return crossed
+}
+
+// fire calls the callbacks of the crossed watchers once all watchers are updated,
+// so that callbacks modifying the tree see consistent values.
+func fire(crossed []*Watcher, values []int) {
+	for i, watcher := range crossed {
+		if watcher.tree != nil {
+			watcher.callback(values[i])
+		}
+	}
+}
+
+// measure returns the value of the measure in the tree.
+func (tree *Tree) measure(measure Measure) int {
+	switch measure.kind {
+	case measureCount:
+		if node := tree.lookup(measure.key); node != nil {
+			return node.NumRepeated + 1
+		}
+		return 0
+	case measureCountGreater:
+		return tree.CountGreater(measure.key)
+	case measureCountSmaller:
+		return tree.CountSmaller(measure.key)
+	default:
+		return tree.Size()
+	}
+}
+
+// notifyWatchers updates the watchers after delta repetitions of key were inserted, or removed if negative.
+// Keys are compared with the comparator directly, so the tree's observer does not count these comparisons.
+func (tree *Tree) notifyWatchers(key interface{}, delta int) {
+	var crossed []*Watcher
+	var values []int
+	for _, watcher := range tree.watchers {
+		if watcher.tree == nil {
+			continue
+		}
+		measure := watcher.condition.measure
+		switch measure.kind {
+		case measureCount:
+			if tree.Comparator(key, measure.key) != 0 {
+				continue
+			}
+		case measureCountGreater:
+			if tree.Comparator(key, measure.key) <= 0 {
+				continue
+			}
+		case measureCountSmaller:
+			if tree.Comparator(key, measure.key) >= 0 {
+				continue
+			}
+		}
+		if watcher.update(watcher.value + delta) {
+			crossed = append(crossed, watcher)
+			values = append(values, watcher.value)
+		}
+	}
+	fire(crossed, values)
+}
+
+// rewatchAll recomputes the measures of all watchers after the tree's content was replaced.
+func (tree *Tree) rewatchAll() {
+	var crossed []*Watcher
+	var values []int
+	for _, watcher := range tree.watchers {
+		if watcher.tree != nil && watcher.update(tree.measure(watcher.condition.measure)) {
+			crossed = append(crossed, watcher)
+			values = append(values, watcher.value)
+		}
+	}
+	fire(crossed, values)
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redblacktree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestRedBlackTreeWatch(t *testing.T) {
+	tree := NewWithIntComparator()
+	tree.PutN(5, 2)
+	var fired []int
+	watcher := tree.Watch(MeasureCountGreater(10).AtLeast(3), func(value int) { fired = append(fired, value) })
+	if watcher.Met() || watcher.Value() != 0 {
+		t.Errorf("Got met %v value %v", watcher.Met(), watcher.Value())
+	}
+	tree.PutN(20, 2)
+	tree.Put(10) // not greater than 10
+	tree.PutN(3, 5)
+	if len(fired) != 0 {
+		t.Errorf("Got %v expected no callback", fired)
+	}
+	tree.PutN(11, 2) // crosses
+	tree.Put(12)     // stays met
+	if len(fired) != 1 || fired[0] != 4 {
+		t.Errorf("Got %v expected [4]", fired)
+	}
+	tree.RemoveN(20, 2) // 3, still met
+	tree.Remove(12)     // 2, not met
+	tree.Put(30)        // crosses again
+	if len(fired) != 2 || fired[1] != 3 {
+		t.Errorf("Got %v expected [4 3]", fired)
+	}
+	if watcher.Value() != tree.CountGreater(10) {
+		t.Errorf("Got value %v expected %v", watcher.Value(), tree.CountGreater(10))
+	}
+
+	watcher.Cancel()
+	watcher.Cancel()
+	tree.Clear()
+	tree.PutN(11, 10)
+	if len(fired) != 2 || tree.watchers != nil {
+		t.Errorf("Got %v after cancelling", fired)
+	}
+}
+
+func TestRedBlackTreeWatchConditions(t *testing.T) {
+	tree := NewWithIntComparator()
+	tree.PutN(1, 2)
+	tree.PutN(2, 1)
+	var events []string
+	watch := func(condition Condition) {
+		tree.Watch(condition, func(value int) { events = append(events, condition.String()) })
+	}
+	watch(MeasureCount(1).Equals(0))
+	watch(MeasureSize().AtMost(1))
+	watch(MeasureSize().AtLeast(5))
+	watch(MeasureCountSmaller(2).AtLeast(3))
+
+	tree.Remove(1)
+	tree.Remove(1) // MeasureCount(1) == 0
+	tree.Remove(2) // MeasureSize() <= 1 not crossed, it went from 1 to 0
+	tree.PutN(3, 6)
+	tree.PutN(1, 3)
+	expected := []string{"MeasureCount(1) == 0", "MeasureSize() <= 1", "MeasureSize() >= 5", "MeasureCountSmaller(2) >= 3"}
+	if len(events) != len(expected) {
+		t.Fatalf("Got %v expected %v", events, expected)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Got %v expected %v", events, expected)
+		}
+	}
+
+	// Clear recomputes the measures
+	events = nil
+	tree.Clear()
+	expected = []string{"MeasureCount(1) == 0", "MeasureSize() <= 1"}
+	if len(events) != 2 || events[0] != expected[0] || events[1] != expected[1] {
+		t.Errorf("Got %v expected %v", events, expected)
+	}
+}
+
+func TestRedBlackTreeWatchReentrant(t *testing.T) {
+	tree := NewWithIntComparator()
+	var cancelled *Watcher
+	tree.Watch(MeasureSize().AtLeast(3), func(value int) {
+		// remove the smallest key, cancelling another watcher on the way
+		tree.RemoveN(tree.Left().Key, 2)
+		cancelled.Cancel()
+	})
+	cancelled = tree.Watch(MeasureCount(1).AtLeast(1), func(value int) { t.Errorf("Cancelled watcher called") })
+	size := tree.Watch(MeasureSize().AtMost(1), func(value int) { t.Errorf("Size watcher called with %v", value) })
+	tree.PutN(2, 2)
+	tree.Put(1)
+	if tree.Size() != 2 || size.Value() != 2 || size.Met() || cancelled.Value() != 0 {
+		t.Errorf("Got size %v watched %v met %v count %v", tree.Size(), size.Value(), size.Met(), cancelled.Value())
+	}
+}
+
+func TestRedBlackTreeWatchObserved(t *testing.T) {
+	watched, unwatched := NewWithIntComparator(), NewWithIntComparator()
+	watchedCounters, unwatchedCounters := &Counters{}, &Counters{}
+	watched.SetObserver(watchedCounters)
+	unwatched.SetObserver(unwatchedCounters)
+	watched.Watch(MeasureCount(3).AtLeast(2), func(value int) {})
+	watched.Watch(MeasureCountGreater(3).AtLeast(2), func(value int) {})
+	for _, key := range []int{3, 1, 4, 1, 5, 9, 2, 6} {
+		watched.Put(key)
+		unwatched.Put(key)
+	}
+	watched.Remove(1)
+	unwatched.Remove(1)
+	if watchedCounters.Comparisons != unwatchedCounters.Comparisons {
+		t.Errorf("Got %v comparisons expected %v", watchedCounters.Comparisons, unwatchedCounters.Comparisons)
+	}
+}
+
+func TestRedBlackTreeWatchRandom(t *testing.T) {
+	tree := NewWithIntComparator()
+	random := rand.New(rand.NewSource(1))
+	conditions := []Condition{
+		MeasureCount(50).AtLeast(3),
+		MeasureCountGreater(100).AtLeast(40),
+		MeasureCountSmaller(30).AtMost(10),
+		MeasureSize().Equals(100),
+	}
+	watchers := make([]*Watcher, len(conditions))
+	fired := make([]int, len(conditions))
+	for i := range conditions {
+		i := i
+		watchers[i] = tree.Watch(conditions[i], func(value int) { fired[i]++ })
+	}
+	expected := make([]int, len(conditions))
+	met := make([]bool, len(conditions))
+	for i := range conditions {
+		met[i] = conditions[i].holds(0)
+	}
+	for step := 0; step < 3000; step++ {
+		key := random.Intn(20) * 10
+		if random.Intn(2) == 0 {
+			tree.RemoveN(key, random.Intn(3)+1)
+		} else {
+			tree.PutN(key, random.Intn(3)+1)
+		}
+		for i, watcher := range watchers {
+			value := tree.measure(conditions[i].Measure())
+			if watcher.Value() != value {
+				t.Fatalf("Step %d: %v has value %v expected %v", step, conditions[i], watcher.Value(), value)
+			}
+			holds := conditions[i].holds(value)
+			if holds && !met[i] {
+				expected[i]++
+			}
+			met[i] = holds
+		}
+	}
+	for i := range conditions {
+		if fired[i] != expected[i] || expected[i] == 0 {
+			t.Errorf("%v fired %v times expected %v", conditions[i], fired[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KeyCodec converts keys to bytes and back.
+//
+// Encode will make type assertion (see IntCodec for example),
+// which will panic if key is not of the asserted type.
+// Decode returns an error if data is not a valid encoding of a key.
+type KeyCodec interface {
+	Encode(key interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// OrdinalKeyCodec is implemented by codecs of integer keys.
+//
+// Ordinal maps a key to an unsigned integer preserving the order of the matching comparator,
+// which lets sorted keys be delta encoded. FromOrdinal is its inverse and returns an error
+// if the ordinal is out of range of the key type.
+type OrdinalKeyCodec interface {
+	KeyCodec
+	Ordinal(key interface{}) uint64
+	FromOrdinal(ordinal uint64) (interface{}, error)
+}
+
+// Built-in codecs matching the built-in comparators.
+// Integers are encoded as (zig-zag) varints, floats as big-endian IEEE 754 bits,
+// strings as their bytes and times in UTC with time.Time.MarshalBinary, so equal instants in
+// different locations have the same encoding and decode as UTC.
+var (
+	StringCodec  KeyCodec = stringCodec{}
+	IntCodec     KeyCodec = intCodec{"int", strconv.IntSize, func(k interface{}) int64 { return int64(k.(int)) }, func(v int64) interface{} { return int(v) }}
+	Int8Codec    KeyCodec = intCodec{"int8", 8, func(k interface{}) int64 { return int64(k.(int8)) }, func(v int64) interface{} { return int8(v) }}
+	Int16Codec   KeyCodec = intCodec{"int16", 16, func(k interface{}) int64 { return int64(k.(int16)) }, func(v int64) interface{} { return int16(v) }}
+	Int32Codec   KeyCodec = intCodec{"int32", 32, func(k interface{}) int64 { return int64(k.(int32)) }, func(v int64) interface{} { return int32(v) }}
+	Int64Codec   KeyCodec = intCodec{"int64", 64, func(k interface{}) int64 { return k.(int64) }, func(v int64) interface{} { return v }}
+	UIntCodec    KeyCodec = uintCodec{"uint", strconv.IntSize, func(k interface{}) uint64 { return uint64(k.(uint)) }, func(v uint64) interface{} { return uint(v) }}
+	UInt8Codec   KeyCodec = uintCodec{"uint8", 8, func(k interface{}) uint64 { return uint64(k.(uint8)) }, func(v uint64) interface{} { return uint8(v) }}
+	UInt16Codec  KeyCodec = uintCodec{"uint16", 16, func(k interface{}) uint64 { return uint64(k.(uint16)) }, func(v uint64) interface{} { return uint16(v) }}
+	UInt32Codec  KeyCodec = uintCodec{"uint32", 32, func(k interface{}) uint64 { return uint64(k.(uint32)) }, func(v uint64) interface{} { return uint32(v) }}
+	UInt64Codec  KeyCodec = uintCodec{"uint64", 64, func(k interface{}) uint64 { return k.(uint64) }, func(v uint64) interface{} { return v }}
+	Float32Codec KeyCodec = float32Codec{}
+	Float64Codec KeyCodec = float64Codec{}
+	ByteCodec    KeyCodec = uintCodec{"byte", 8, func(k interface{}) uint64 { return uint64(k.(byte)) }, func(v uint64) interface{} { return byte(v) }}
+	RuneCodec    KeyCodec = intCodec{"rune", 32, func(k interface{}) int64 { return int64(k.(rune)) }, func(v int64) interface{} { return rune(v) }}
+	TimeCodec    KeyCodec = timeCodec{}
+)
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(key interface{}) ([]byte, error) {
+	return []byte(key.(string)), nil
+}
+
+func (stringCodec) Decode(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+type intCodec struct {
+	name    string
+	bits    uint
+	toInt   func(interface{}) int64
+	fromInt func(int64) interface{}
+}
+
+func (codec intCodec) Encode(key interface{}) ([]byte, error) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutVarint(buf, codec.toInt(key))], nil
+}
+
+func (codec intCodec) Decode(data []byte) (interface{}, error) {
+	value, n := binary.Varint(data)
+	if n <= 0 || n != len(data) {
+		return nil, fmt.Errorf("utils: invalid %s encoding %x", codec.name, data)
+	}
+	if codec.bits < 64 && (value < -1<<(codec.bits-1) || value >= 1<<(codec.bits-1)) {
+		return nil, fmt.Errorf("utils: %d overflows %s", value, codec.name)
+	}
+	return codec.fromInt(value), nil
+}
+
+func (codec intCodec) Ordinal(key interface{}) uint64 {
+	return uint64(codec.toInt(key)) ^ 1<<63
+}
+
+func (codec intCodec) FromOrdinal(ordinal uint64) (interface{}, error) {
+	value := int64(ordinal ^ 1<<63)
+	if codec.bits < 64 && (value < -1<<(codec.bits-1) || value >= 1<<(codec.bits-1)) {
+		return nil, fmt.Errorf("utils: %d overflows %s", value, codec.name)
+	}
+	return codec.fromInt(value), nil
+}
+
+type uintCodec struct {
+	name     string
+	bits     uint
+	toUint   func(interface{}) uint64
+	fromUint func(uint64) interface{}
+}
+
+func (codec uintCodec) Encode(key interface{}) ([]byte, error) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, codec.toUint(key))], nil
+}
+
+func (codec uintCodec) Decode(data []byte) (interface{}, error) {
+	value, n := binary.Uvarint(data)
+	if n <= 0 || n != len(data) {
+		return nil, fmt.Errorf("utils: invalid %s encoding %x", codec.name, data)
+	}
+	if codec.bits < 64 && value >= 1<<codec.bits {
+		return nil, fmt.Errorf("utils: %d overflows %s", value, codec.name)
+	}
+	return codec.fromUint(value), nil
+}
+
+func (codec uintCodec) Ordinal(key interface{}) uint64 {
+	return codec.toUint(key)
+}
+
+func (codec uintCodec) FromOrdinal(ordinal uint64) (interface{}, error) {
+	if codec.bits < 64 && ordinal >= 1<<codec.bits {
+		return nil, fmt.Errorf("utils: %d overflows %s", ordinal, codec.name)
+	}
+	return codec.fromUint(ordinal), nil
+}
+
+type float32Codec struct{}
+
+func (float32Codec) Encode(key interface{}) ([]byte, error) {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, math.Float32bits(key.(float32)))
+	return buf, nil
+}
+
+func (float32Codec) Decode(data []byte) (interface{}, error) {
+	if len(data) != 4 {
+		return nil, fmt.Errorf("utils: invalid float32 encoding %x", data)
+	}
+	return math.Float32frombits(binary.BigEndian.Uint32(data)), nil
+}
+
+type float64Codec struct{}
+
+func (float64Codec) Encode(key interface{}) ([]byte, error) {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(key.(float64)))
+	return buf, nil
+}
+
+func (float64Codec) Decode(data []byte) (interface{}, error) {
+	if len(data) != 8 {
+		return nil, fmt.Errorf("utils: invalid float64 encoding %x", data)
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+}
+
+type timeCodec struct{}
+
+func (timeCodec) Encode(key interface{}) ([]byte, error) {
+	return key.(time.Time).UTC().MarshalBinary()
+}
+
+func (timeCodec) Decode(data []byte) (interface{}, error) {
+	var t time.Time
+	if err := t.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// KeyType associates a stable name with the Go type of keys and the codec and comparator for them,
+// so serialized trees can record which comparator and codec to restore with.
+type KeyType struct {
+	Name       string
+	Type       reflect.Type
+	Codec      KeyCodec
+	Comparator Comparator
+}
+
+var keyTypes = struct {
+	sync.RWMutex
+	byName       map[string]KeyType
+	byComparator map[uintptr]KeyType
+}{
+	byName:       make(map[string]KeyType),
+	byComparator: make(map[uintptr]KeyType),
+}
+
+func init() {
+	RegisterKeyType(KeyType{"string", reflect.TypeOf(""), StringCodec, StringComparator})
+	RegisterKeyType(KeyType{"int", reflect.TypeOf(int(0)), IntCodec, IntComparator})
+	RegisterKeyType(KeyType{"int8", reflect.TypeOf(int8(0)), Int8Codec, Int8Comparator})
+	RegisterKeyType(KeyType{"int16", reflect.TypeOf(int16(0)), Int16Codec, Int16Comparator})
+	RegisterKeyType(KeyType{"int32", reflect.TypeOf(int32(0)), Int32Codec, Int32Comparator})
+	RegisterKeyType(KeyType{"int64", reflect.TypeOf(int64(0)), Int64Codec, Int64Comparator})
+	RegisterKeyType(KeyType{"uint", reflect.TypeOf(uint(0)), UIntCodec, UIntComparator})
+	RegisterKeyType(KeyType{"uint8", reflect.TypeOf(uint8(0)), UInt8Codec, UInt8Comparator})
+	RegisterKeyType(KeyType{"uint16", reflect.TypeOf(uint16(0)), UInt16Codec, UInt16Comparator})
+	RegisterKeyType(KeyType{"uint32", reflect.TypeOf(uint32(0)), UInt32Codec, UInt32Comparator})
+	RegisterKeyType(KeyType{"uint64", reflect.TypeOf(uint64(0)), UInt64Codec, UInt64Comparator})
+	RegisterKeyType(KeyType{"float32", reflect.TypeOf(float32(0)), Float32Codec, Float32Comparator})
+	RegisterKeyType(KeyType{"float64", reflect.TypeOf(float64(0)), Float64Codec, Float64Comparator})
+	RegisterKeyType(KeyType{"byte", reflect.TypeOf(byte(0)), ByteCodec, ByteComparator})
+	RegisterKeyType(KeyType{"rune", reflect.TypeOf(rune(0)), RuneCodec, RuneComparator})
+	RegisterKeyType(KeyType{"time", reflect.TypeOf(time.Time{}), TimeCodec, TimeComparator})
+}
+
+// RegisterKeyType makes a key type available under its name to all serialization formats.
+// The comparator must be a top-level function: closures created by the same function literal are indistinguishable.
+// Panics if the name or the comparator is already registered.
+func RegisterKeyType(keyType KeyType) {
+	if keyType.Name == "" || keyType.Type == nil || keyType.Codec == nil || keyType.Comparator == nil {
+		panic("utils: RegisterKeyType requires a name, type, codec and comparator")
+	}
+	keyTypes.Lock()
+	defer keyTypes.Unlock()
+	if _, dup := keyTypes.byName[keyType.Name]; dup {
+		panic("utils: RegisterKeyType called twice for name " + keyType.Name)
+	}
+	comparator := comparatorID(keyType.Comparator)
+	if registered, dup := keyTypes.byComparator[comparator]; dup {
+		panic("utils: comparator of key type " + keyType.Name + " is already registered as " + registered.Name)
+	}
+	keyTypes.byName[keyType.Name] = keyType
+	keyTypes.byComparator[comparator] = keyType
+}
+
+// KeyTypeByName returns the key type registered under the name.
+func KeyTypeByName(name string) (KeyType, bool) {
+	keyTypes.RLock()
+	defer keyTypes.RUnlock()
+	keyType, found := keyTypes.byName[name]
+	return keyType, found
+}
+
+// KeyTypeOf returns the key type registered with the comparator.
+func KeyTypeOf(comparator Comparator) (KeyType, bool) {
+	if comparator == nil {
+		return KeyType{}, false
+	}
+	keyTypes.RLock()
+	defer keyTypes.RUnlock()
+	keyType, found := keyTypes.byComparator[comparatorID(comparator)]
+	return keyType, found
+}
+
+// comparatorID identifies a comparator by its code pointer since functions are not comparable.
+func comparatorID(comparator Comparator) uintptr {
+	return reflect.ValueOf(comparator).Pointer()
+}
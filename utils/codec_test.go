@@ -0,0 +1,187 @@
+// Copyright (c) 2015, Emir Pasic. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCodecsRoundTrip(t *testing.T) {
+	// name, keys
+	tests := [][]interface{}{
+		{"string", []interface{}{"", "a", "hello, world"}},
+		{"int", []interface{}{0, 1, -1, math.MaxInt32, math.MinInt32}},
+		{"int8", []interface{}{int8(0), int8(math.MaxInt8), int8(math.MinInt8)}},
+		{"int16", []interface{}{int16(0), int16(math.MaxInt16), int16(math.MinInt16)}},
+		{"int32", []interface{}{int32(0), int32(math.MaxInt32), int32(math.MinInt32)}},
+		{"int64", []interface{}{int64(0), int64(math.MaxInt64), int64(math.MinInt64)}},
+		{"uint", []interface{}{uint(0), uint(math.MaxUint32)}},
+		{"uint8", []interface{}{uint8(0), uint8(math.MaxUint8)}},
+		{"uint16", []interface{}{uint16(0), uint16(math.MaxUint16)}},
+		{"uint32", []interface{}{uint32(0), uint32(math.MaxUint32)}},
+		{"uint64", []interface{}{uint64(0), uint64(math.MaxUint64)}},
+		{"float32", []interface{}{float32(0), float32(-1.5), float32(math.MaxFloat32)}},
+		{"float64", []interface{}{0.0, -1.5, math.Inf(1), math.SmallestNonzeroFloat64}},
+		{"byte", []interface{}{byte(0), byte('x')}},
+		{"rune", []interface{}{rune(0), 'ж'}},
+		{"time", []interface{}{time.Time{}, time.Date(2020, 5, 17, 10, 0, 0, 42, time.UTC)}},
+	}
+
+	for _, test := range tests {
+		keyType, found := KeyTypeByName(test[0].(string))
+		if !found {
+			t.Errorf("Key type %v not registered", test[0])
+			continue
+		}
+		for _, key := range test[1].([]interface{}) {
+			if actualValue, expectedValue := keyType.Type, reflect.TypeOf(key); actualValue != expectedValue {
+				t.Errorf("Got %v expected %v", actualValue, expectedValue)
+			}
+			data, err := keyType.Codec.Encode(key)
+			if err != nil {
+				t.Errorf("Got error %v", err)
+			}
+			decoded, err := keyType.Codec.Decode(data)
+			if err != nil {
+				t.Errorf("Got error %v", err)
+			}
+			if keyType.Comparator(decoded, key) != 0 {
+				t.Errorf("Got %v expected %v", decoded, key)
+			}
+		}
+	}
+}
+
+func TestTimeCodecLocations(t *testing.T) {
+	instant := time.Date(2020, 5, 17, 10, 0, 0, 42, time.UTC)
+	utc, _ := TimeCodec.Encode(instant)
+	local, _ := TimeCodec.Encode(instant.In(time.FixedZone("UTC+3", 3*60*60)))
+	if !bytes.Equal(utc, local) {
+		t.Errorf("Got %x expected %x", local, utc)
+	}
+	decoded, _ := TimeCodec.Decode(local)
+	if actualValue, expectedValue := decoded.(time.Time), instant; actualValue != expectedValue {
+		t.Errorf("Got %v expected %v", actualValue, expectedValue)
+	}
+}
+
+func TestCodecsDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		codec KeyCodec
+		data  []byte
+		err   string
+	}{
+		{IntCodec, []byte{}, "invalid int encoding"},
+		{IntCodec, []byte{0x02, 0x02}, "invalid int encoding"},
+		{Int8Codec, []byte{0x80, 0x02}, "128 overflows int8"},
+		{UInt16Codec, []byte{0x80, 0x80, 0x04}, "65536 overflows uint16"},
+		{Float64Codec, []byte{0x00}, "invalid float64 encoding"},
+		{Float32Codec, []byte{0x00}, "invalid float32 encoding"},
+		{TimeCodec, []byte{0x00}, "Time"},
+	}
+	for _, test := range tests {
+		if _, err := test.codec.Decode(test.data); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Got %v expected %v", err, test.err)
+		}
+	}
+}
+
+func TestKeyTypeOf(t *testing.T) {
+	if keyType, found := KeyTypeOf(IntComparator); !found || keyType.Name != "int" {
+		t.Errorf("Got %v expected %v", keyType.Name, "int")
+	}
+	if keyType, found := KeyTypeOf(ByteComparator); !found || keyType.Name != "byte" {
+		t.Errorf("Got %v expected %v", keyType.Name, "byte")
+	}
+	if _, found := KeyTypeOf(nil); found {
+		t.Errorf("Got %v expected %v", found, false)
+	}
+	if _, found := KeyTypeOf(func(a, b interface{}) int { return 0 }); found {
+		t.Errorf("Got %v expected %v", found, false)
+	}
+}
+
+type pointCodec struct{}
+
+type point struct{ x, y int8 }
+
+func (pointCodec) Encode(key interface{}) ([]byte, error) {
+	p := key.(point)
+	return []byte{byte(p.x), byte(p.y)}, nil
+}
+
+func (pointCodec) Decode(data []byte) (interface{}, error) {
+	return point{int8(data[0]), int8(data[1])}, nil
+}
+
+func pointComparator(a, b interface{}) int {
+	p, q := a.(point), b.(point)
+	if c := Int8Comparator(p.x, q.x); c != 0 {
+		return c
+	}
+	return Int8Comparator(p.y, q.y)
+}
+
+func TestRegisterKeyType(t *testing.T) {
+	RegisterKeyType(KeyType{"utils_test.point", reflect.TypeOf(point{}), pointCodec{}, pointComparator})
+	keyType, found := KeyTypeOf(pointComparator)
+	if !found || keyType.Name != "utils_test.point" {
+		t.Errorf("Got %v expected %v", keyType.Name, "utils_test.point")
+	}
+
+	assertPanics := func(keyType KeyType) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected panic registering %v", keyType.Name)
+			}
+		}()
+		RegisterKeyType(keyType)
+	}
+	assertPanics(KeyType{"utils_test.point", reflect.TypeOf(point{}), pointCodec{}, IntComparator})
+	assertPanics(KeyType{"utils_test.point2", reflect.TypeOf(point{}), pointCodec{}, pointComparator})
+	assertPanics(KeyType{Name: "utils_test.point3"})
+}
+
+func TestOrdinalKeyCodecs(t *testing.T) {
+	// codec, ordered keys
+	tests := [][]interface{}{
+		{IntCodec, []interface{}{math.MinInt32, -1, 0, 1, math.MaxInt32}},
+		{Int8Codec, []interface{}{int8(math.MinInt8), int8(0), int8(math.MaxInt8)}},
+		{Int64Codec, []interface{}{int64(math.MinInt64), int64(-1), int64(math.MaxInt64)}},
+		{UInt16Codec, []interface{}{uint16(0), uint16(1), uint16(math.MaxUint16)}},
+		{UInt64Codec, []interface{}{uint64(0), uint64(math.MaxUint64)}},
+	}
+	for _, test := range tests {
+		codec := test[0].(OrdinalKeyCodec)
+		keys := test[1].([]interface{})
+		for i, key := range keys {
+			ordinal := codec.Ordinal(key)
+			if i > 0 && codec.Ordinal(keys[i-1]) >= ordinal {
+				t.Errorf("Ordinal of %v not greater than of %v", key, keys[i-1])
+			}
+			if decoded, err := codec.FromOrdinal(ordinal); err != nil || decoded != key {
+				t.Errorf("Got %v, %v expected %v", decoded, err, key)
+			}
+		}
+	}
+
+	if _, err := Int8Codec.(OrdinalKeyCodec).FromOrdinal(1 << 63); err != nil {
+		t.Errorf("Got error %v", err)
+	}
+	if _, err := Int8Codec.(OrdinalKeyCodec).FromOrdinal(1<<63 + 128); err == nil {
+		t.Errorf("Expected overflow error")
+	}
+	if _, err := UInt8Codec.(OrdinalKeyCodec).FromOrdinal(256); err == nil {
+		t.Errorf("Expected overflow error")
+	}
+	if _, ok := Float64Codec.(OrdinalKeyCodec); ok {
+		t.Errorf("Float64Codec shouldn't be ordinal")
+	}
+}
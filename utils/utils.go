@@ -7,6 +7,7 @@
 // Provided functionalities:
 // - sorting
 // - comparators
+// - key codecs and key type registry
 package utils
 
 import (